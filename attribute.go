@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type AttrFlags uint
+
+//
+// Attribute flags. A plain attribute can be seen and changed by
+// whoever controls its object. A visible one can be seen by anyone.
+// A wizard one can only be seen or changed by wizards. A locked one
+// can still be seen, but only wizards can change or clear it.
+//
+const (
+	AttrVisible AttrFlags = 1 << iota
+	AttrWizard
+	AttrLocked
+)
+
+// Attribute flags by name, in the order they're listed.
+var attrFlagNames = []struct {
+	name string
+	flag AttrFlags
+}{
+	{"visible", AttrVisible},
+	{"wizard", AttrWizard},
+	{"locked", AttrLocked},
+}
+
+func ParseAttrFlag(name string) (AttrFlags, error) {
+	for _, f := range attrFlagNames {
+		if f.name == strings.ToLower(name) {
+			return f.flag, nil
+		}
+	}
+
+	return 0, fmt.Errorf("I don't know the attribute flag '%s'.", name)
+}
+
+func (f AttrFlags) String() string {
+	var names []string
+
+	for _, n := range attrFlagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+		}
+	}
+
+	return strings.Join(names, " ")
+}
+
+//
+// A named value stored on an object by builders, for scripts and
+// messages to use. Names are kept in upper case, and looked up
+// without regard to case.
+//
+type Attribute struct {
+	Name  string
+	Value string
+	Flags AttrFlags
+}
+
+// The attributes on an object, by name.
+type Attributes map[string]*Attribute
+
+func normalAttrName(name string) string {
+	return strings.ToUpper(strings.TrimSpace(name))
+}
+
+//
+// Letters, digits, and "_", "-" or ".", up to 32 of them. Verbs, which
+// hold programs, also start with a "$".
+//
+func validAttrName(name string) bool {
+	if name == "" || len(name) > 32 || name == "$" {
+		return false
+	}
+
+	for i, c := range name {
+		switch {
+		case c == '$' && i == 0:
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '_' || c == '-' || c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (o *Object) Attribute(name string) (Attribute, bool) {
+	a, exists := o.attrs[normalAttrName(name)]
+
+	if !exists {
+		return Attribute{}, false
+	}
+
+	return *a, true
+}
+
+// Every attribute on the object, sorted by name.
+func (o *Object) Attributes() []Attribute {
+	attrs := make([]Attribute, 0, len(o.attrs))
+
+	for _, a := range o.attrs {
+		attrs = append(attrs, *a)
+	}
+
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+
+	return attrs
+}
+
+// Set an attribute's value, keeping its flags if it already exists.
+func (o *Object) SetAttribute(name string, value string) {
+	name = normalAttrName(name)
+
+	if a, exists := o.attrs[name]; exists {
+		a.Value = value
+		return
+	}
+
+	if o.attrs == nil {
+		o.attrs = make(Attributes)
+	}
+
+	o.attrs[name] = &Attribute{Name: name, Value: value}
+}
+
+func (o *Object) ClearAttribute(name string) {
+	delete(o.attrs, normalAttrName(name))
+}
+
+func (o *Object) SetAttributeFlags(name string, f AttrFlags) {
+	if a, exists := o.attrs[normalAttrName(name)]; exists {
+		a.Flags = f
+	}
+}
+
+// May the player see the attribute?
+func canSeeAttr(p *Player, o Objecter, a Attribute) bool {
+	if p.IsSet(WizardFlag) {
+		return true
+	}
+
+	if a.Flags&AttrWizard != 0 {
+		return false
+	}
+
+	return a.Flags&AttrVisible != 0 || controls(p, o)
+}
+
+//
+// May the player set, clear or change the flags of the named
+// attribute? It needn't exist yet.
+//
+func canSetAttr(p *Player, o Objecter, name string) bool {
+	if p.IsSet(WizardFlag) {
+		return true
+	}
+
+	if a, exists := o.Attribute(name); exists && a.Flags&(AttrWizard|AttrLocked) != 0 {
+		return false
+	}
+
+	return controls(p, o)
+}
+
+//
+// Split "object/attribute" into its parts. The object is everything
+// up to the last slash, so it may be empty, meaning here.
+//
+func splitAttrTarget(s string) (object string, attr string, ok bool) {
+	i := strings.LastIndex(s, "/")
+
+	if i < 0 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+}
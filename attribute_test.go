@@ -0,0 +1,197 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttributesAreCaseInsensitive(t *testing.T) {
+	o := &Object{}
+	o.SetAttribute("Color", "red")
+	o.SetAttributeFlags("COLOR", AttrVisible)
+	o.SetAttribute("color", "blue")
+
+	a, exists := o.Attribute("cOLOR")
+
+	if !exists || a.Name != "COLOR" || a.Value != "blue" || a.Flags != AttrVisible {
+		t.Errorf("Unexpected attribute %+v", a)
+	}
+
+	o.ClearAttribute("Color")
+
+	if _, exists = o.Attribute("color"); exists || len(o.Attributes()) != 0 {
+		t.Errorf("Expected the attribute to be cleared")
+	}
+}
+
+func TestValidAttrName(t *testing.T) {
+	for _, name := range []string{"color", "SMELL_2", "on-enter", "a.b"} {
+		if !validAttrName(name) {
+			t.Errorf("Expected %q to be a valid name", name)
+		}
+	}
+
+	for _, name := range []string{"", "two words", "a=b", "a/b", "0123456789012345678901234567890123"} {
+		if validAttrName(name) {
+			t.Errorf("Expected %q not to be a valid name", name)
+		}
+	}
+}
+
+func newAttributeTest() (*World, *Client, *MockConn, *Player, *Thing) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	lamp, _ := world.NewThing("Lamp", hall)
+	world.SetOwner(lamp, bob)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	return world, client, conn, bob, lamp
+}
+
+func TestAmpersandSetsAttributes(t *testing.T) {
+	world, client, conn, _, lamp := newAttributeTest()
+
+	cmd, _ := parseCommand(client, "&color lamp=a dull brass")
+	doAttr(world, client, cmd)
+
+	if a, _ := lamp.Attribute("color"); a.Value != "a dull brass" {
+		t.Fatalf("Expected the lamp's color to be set, got %q", a.Value)
+	}
+
+	doGetAttr(world, client, Command{"@get", "lamp/Color", ""})
+
+	assertMatch(t, "Set.\r\na dull brass\r\n", conn.String())
+
+	cmd, _ = parseCommand(client, "&color lamp")
+	doAttr(world, client, cmd)
+
+	if _, exists := lamp.Attribute("color"); exists {
+		t.Errorf("Expected '&color lamp' to clear the attribute")
+	}
+
+	world.SetOwner(client.player.location, client.player)
+	cmd, _ = parseCommand(client, "&smell =damp")
+	doAttr(world, client, cmd)
+
+	if a, _ := client.player.location.Attribute("smell"); a.Value != "damp" {
+		t.Errorf("Expected the attribute to be set on the room, got %q", a.Value)
+	}
+}
+
+func TestAttributePermissions(t *testing.T) {
+	world, client, conn, bob, lamp := newAttributeTest()
+	world.SetAttribute(lamp, "secret", "xyzzy")
+
+	jimConn := NewMockConn()
+	jim := NewClient(jimConn)
+	world.NewPlayer("jim", "bar", bob.location)
+	doConnect(world, jim, Command{"connect", "", "jim bar"})
+
+	doGetAttr(world, jim, Command{"@get", "lamp/secret", ""})
+	doAttr(world, jim, Command{"@attr", "lamp/secret", "plugh"})
+
+	assertMatch(t, "Lamp has no attribute SECRET.\r\nYou can't do that.\r\n", jimConn.String())
+
+	doAttrFlag(world, client, Command{"@aflag", "lamp/secret", "visible"})
+	doGetAttr(world, jim, Command{"@get", "lamp/secret", ""})
+
+	assertMatch(t, "xyzzy\r\n", jimConn.String())
+
+	// Only wizards can lock attributes, and then even the owner
+	// can't change them.
+	doAttrFlag(world, client, Command{"@aflag", "lamp/secret", "locked"})
+
+	assertMatch(t, "You can't do that.\r\n", conn.String())
+
+	bob.SetFlag(WizardFlag)
+	doAttrFlag(world, client, Command{"@aflag", "lamp/secret", "locked"})
+	bob.ClearFlag(WizardFlag)
+	doAttr(world, client, Command{"@attr", "lamp/secret", "plugh"})
+	doClear(world, client, Command{"@clear", "lamp/secret", ""})
+
+	if a, _ := lamp.Attribute("secret"); a.Value != "xyzzy" || a.Flags != AttrVisible|AttrLocked {
+		t.Errorf("Expected the locked attribute to be left alone, got %+v", a)
+	}
+
+	doExamine(world, client, Command{"examine", "lamp", ""})
+
+	assertMatch(t, "SECRET \\[visible locked\\]: xyzzy\r\n", conn.String())
+
+	world.SetAttributeFlags(lamp, "secret", AttrWizard)
+	jimConn.writeBuffer.Reset()
+	doExamine(world, jim, Command{"examine", "lamp", ""})
+
+	if !strings.Contains(jimConn.String(), "Lamp (#3)") || strings.Contains(jimConn.String(), "SECRET") {
+		t.Errorf("Expected wizard attributes to be hidden from jim")
+	}
+}
+
+func TestPlayersSetTheirOwnAttributes(t *testing.T) {
+	world, client, _, bob, _ := newAttributeTest()
+
+	runLine(world, client, "&mood me=cheerful")
+
+	if a, _ := bob.Attribute("mood"); a.Value != "cheerful" {
+		t.Fatalf("Expected bob to be able to set his own attribute, got %q", a.Value)
+	}
+
+	jim := NewClient(NewMockConn())
+	world.NewPlayer("jim", "bar", bob.location)
+	doConnect(world, jim, Command{"connect", "", "jim bar"})
+	runLine(world, jim, "&mood bob=grumpy")
+
+	if a, _ := bob.Attribute("mood"); a.Value != "cheerful" {
+		t.Errorf("Expected jim not to be able to set bob's attribute")
+	}
+
+	// Programs on a player run as that player.
+	bob.SetFlag(ProgrammerFlag)
+	runLine(world, client, `&$cheer me=(set-attr me "mood" "elated")`)
+	runLine(world, client, "cheer me")
+
+	if a, _ := bob.Attribute("mood"); a.Value != "elated" {
+		t.Errorf("Expected bob's own verb to set his mood, got %q", a.Value)
+	}
+}
+
+func TestAttributesArePersistedAndJournaled(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "world.json")
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.SetAttribute(hall, "smell", "damp")
+	world.SetAttributeFlags(hall, "smell", AttrVisible)
+	world.Save(snapshot)
+
+	loaded := reloadWorld(t, world)
+
+	if a, _ := loaded.rooms[hall.key].Attribute("smell"); a.Value != "damp" || a.Flags != AttrVisible {
+		t.Fatalf("Expected the attribute to be restored, got %+v", a)
+	}
+
+	path := openTestJournal(t, world)
+	world.ClearAttribute(hall, "smell")
+	world.SetAttribute(hall, "sound", "dripping")
+	world.SetAttributeFlags(hall, "sound", AttrLocked)
+
+	replayed, _ := LoadWorld(snapshot)
+
+	if _, err := ReplayJournal(replayed, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	r := replayed.rooms[hall.key]
+
+	if _, exists := r.Attribute("smell"); exists {
+		t.Errorf("Expected the smell to be cleared after replay")
+	}
+
+	if a, _ := r.Attribute("sound"); a.Value != "dripping" || a.Flags != AttrLocked {
+		t.Errorf("Expected the sound to be set after replay, got %+v", a)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+//
+// What happens to the key of a destroyed object.
+//
+type KeyPolicy uint8
+
+const (
+	// Never hand the key out again, so that an old reference to
+	// "#12" can't quietly come to mean something else.
+	TombstoneKeys KeyPolicy = iota
+	// Give the key to the next object created.
+	RecycleKeys
+)
+
+func ParseKeyPolicy(s string) (KeyPolicy, error) {
+	switch s {
+	case "tombstone":
+		return TombstoneKeys, nil
+	case "recycle":
+		return RecycleKeys, nil
+	}
+
+	return TombstoneKeys, fmt.Errorf("Unknown key policy '%s'", s)
+}
+
+//
+// Hand out the key for a new object. Whatever the policy, destroyed
+// keys are remembered, so they're saved with the world and the
+// policy can be changed later.
+//
+func (w *World) newKey() int {
+	if w.keyPolicy == RecycleKeys && len(w.freeKeys) > 0 {
+		key := w.freeKeys[0]
+		w.freeKeys = w.freeKeys[1:]
+		return key
+	}
+
+	return w.idGen()
+}
+
+// Take a key out of the free list, if it's there. Used when
+// replaying the creation of an object with a recycled key.
+func (w *World) claimKey(key int) {
+	for i, k := range w.freeKeys {
+		if k == key {
+			w.freeKeys = append(w.freeKeys[:i:i], w.freeKeys[i+1:]...)
+			return
+		}
+	}
+}
+
+//
+// Give up a destroyed object's key. Its event handlers go with it, so
+// they can't fire for whatever gets the key next.
+//
+func (w *World) freeKey(key int) {
+	w.freeKeys = append(w.freeKeys, key)
+	sort.Ints(w.freeKeys)
+	delete(w.subscribers, key)
+}
+
+//
+// The room players are sent to when their room is destroyed. It
+// can't be destroyed itself.
+//
+func (w *World) safeRoom() *Room {
+	return w.rooms[START_ROOM]
+}
+
+//
+// Destroy a room, exit or thing.
+//
+// Destroying a room takes its exits with it, and leaves any exits
+// that led to it going nowhere. Players and things in the room are
+// moved to the safe room. Destroying a thing drops whatever was in
+// it where the thing was.
+//
+func (w *World) Destroy(o Objecter) error {
+	displaced, err := w.destroy(o)
+
+	if err != nil {
+		return err
+	}
+
+	w.record(JournalEntry{Op: opDestroy, Key: o.Key()})
+
+	for _, p := range displaced {
+		if p.client != nil {
+			p.client.Tell("%s crumbles away around you!", o.Name())
+			p.client.sendRoomInfo(p.location)
+			p.client.lookAt(p.location)
+		}
+	}
+
+	return nil
+}
+
+// Returns the players that had to be moved.
+func (w *World) destroy(o Objecter) ([]*Player, error) {
+	switch o := o.(type) {
+	case *Room:
+		return w.destroyRoom(o)
+	case *Exit:
+		w.destroyExit(o)
+	case *Thing:
+		w.destroyThing(o)
+	case *Player:
+		return nil, errors.New("Players can't be destroyed.")
+	default:
+		return nil, errors.New("That can't be destroyed.")
+	}
+
+	return nil, nil
+}
+
+func (w *World) destroyRoom(r *Room) ([]*Player, error) {
+	safe := w.safeRoom()
+
+	if safe == nil || r == safe {
+		return nil, errors.New("That room can't be destroyed.")
+	}
+
+	for _, e := range r.exits {
+		w.destroyExit(e)
+	}
+
+	for _, e := range w.exits {
+		if e.destination == r {
+			e.destination = nil
+		}
+	}
+
+	var displaced []*Player
+
+	for _, p := range r.players {
+		w.movePlayer(p, safe)
+		displaced = append(displaced, p)
+	}
+
+	// Can't fail, the safe room isn't a thing.
+	for _, t := range r.Things() {
+		w.moveThing(t, safe)
+	}
+
+	delete(w.rooms, r.key)
+	w.freeKey(r.key)
+
+	return displaced, nil
+}
+
+func (w *World) destroyExit(e *Exit) {
+	for _, r := range w.rooms {
+		delete(r.exits, e.key)
+	}
+
+	delete(w.exits, e.key)
+	w.freeKey(e.key)
+}
+
+func (w *World) destroyThing(t *Thing) {
+	for _, inner := range t.Things() {
+		w.moveThing(inner, t.location)
+	}
+
+	t.location.contents().remove(t)
+	t.location = nil
+
+	delete(w.things, t.key)
+	w.freeKey(t.key)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDestroyRoom(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	in, _ := world.NewExit(hall, "in", den)
+	out, _ := world.NewExit(den, "out", hall)
+	bob, _ := world.NewPlayer("bob", "foo", den)
+	lamp, _ := world.NewThing("Lamp", den)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	if err := world.Destroy(den); err != nil {
+		t.Fatalf("Could not destroy the den: %s", err)
+	}
+
+	if _, exists := world.rooms[den.key]; exists {
+		t.Errorf("Expected the den to be gone")
+	}
+
+	if _, exists := world.exits[out.key]; exists {
+		t.Errorf("Expected the den's exits to go with it")
+	}
+
+	if in.destination != nil || world.exits[in.key] != in {
+		t.Errorf("Expected the exit into the den to be unlinked")
+	}
+
+	if bob.location != hall || lamp.Location() != hall {
+		t.Errorf("Expected bob and the lamp to be moved to the hall")
+	}
+
+	assertMatch(t, "The Den crumbles away around you!\r\nThe Hall \\(#1\\)", conn.String())
+
+	doMove(world, client, Command{"move", "in", ""})
+
+	assertMatch(t, "That exit doesn't lead anywhere.\r\n", conn.String())
+}
+
+func TestSafeRoomCantBeDestroyed(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+
+	if err := world.Destroy(hall); err == nil {
+		t.Errorf("Expected the safe room to be kept")
+	}
+}
+
+func TestDestroyThingDropsContents(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	bag, _ := world.NewThing("Bag", bob)
+	coin, _ := world.NewThing("Coin", bag)
+
+	world.Destroy(bag)
+
+	if _, exists := world.things[bag.key]; exists || bob.FindThing("bag") != nil {
+		t.Errorf("Expected the bag to be gone")
+	}
+
+	if coin.Location() != bob {
+		t.Errorf("Expected bob to be left holding the coin")
+	}
+}
+
+func TestDoDestroyChecksOwnership(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	lamp, _ := world.NewThing("Lamp", hall)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	doDestroy(world, client, Command{"@destroy", "lamp", ""})
+
+	if _, exists := world.things[lamp.key]; !exists {
+		t.Fatalf("Expected bob not to be able to destroy the lamp")
+	}
+
+	world.SetOwner(lamp, bob)
+	doDestroy(world, client, Command{"@destroy", "lamp", ""})
+
+	if _, exists := world.things[lamp.key]; exists {
+		t.Errorf("Expected bob to be able to destroy his lamp")
+	}
+
+	bob.SetFlag(WizardFlag)
+	doDestroy(world, client, Command{"@destroy", "#2", ""})
+
+	if _, exists := world.rooms[den.key]; exists {
+		t.Errorf("Expected a wizard to be able to destroy a room by number")
+	}
+
+	assertMatch(t, "Destroyed The Den \\(#2\\).\r\n", conn.String())
+}
+
+func TestKeyPolicy(t *testing.T) {
+	world := NewWorld()
+	world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	world.Destroy(den)
+
+	if attic, _ := world.NewRoom("The Attic"); attic.key != 3 {
+		t.Errorf("Expected a tombstoned key not to be reused, got #%d", attic.key)
+	}
+
+	world.keyPolicy = RecycleKeys
+
+	if cellar, _ := world.NewRoom("The Cellar"); cellar.key != den.key {
+		t.Errorf("Expected the den's key to be recycled, got #%d", cellar.key)
+	}
+
+	if _, err := ParseKeyPolicy("shred"); err == nil {
+		t.Errorf("Expected an unknown policy to be rejected")
+	}
+}
+
+func TestDestroyIsJournaled(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "world.json")
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("bob", "foo", hall)
+	world.Save(snapshot)
+
+	path := openTestJournal(t, world)
+	den, _ := world.NewRoom("The Den")
+	world.NewExit(hall, "in", den)
+	world.Destroy(den)
+
+	loaded, _ := LoadWorld(snapshot)
+
+	if _, err := ReplayJournal(loaded, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	if _, exists := loaded.rooms[den.key]; exists {
+		t.Errorf("Expected the den to be destroyed on replay")
+	}
+
+	// The den was the last key handed out, and must not be reused
+	// just because nothing has it any more.
+	if attic, _ := loaded.NewRoom("The Attic"); attic.key != 5 {
+		t.Errorf("Expected the next key to be 5, got #%d", attic.key)
+	}
+
+	reloaded := reloadWorld(t, loaded)
+	reloaded.keyPolicy = RecycleKeys
+
+	if cellar, _ := reloaded.NewRoom("The Cellar"); cellar.key != den.key {
+		t.Errorf("Expected free keys to be saved, got #%d", cellar.key)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+//
+// Things that happen in a room, which objects there can react to.
+//
+const (
+	EventEnter      = "enter"
+	EventLeave      = "leave"
+	EventSay        = "say"
+	EventConnect    = "connect"
+	EventDisconnect = "disconnect"
+)
+
+// How deeply handlers may set off events of their own.
+const maxEventDepth = 8
+
+//
+// Something that happened. Text is what was said, for speech.
+//
+type Event struct {
+	Kind  string
+	Actor *Player
+	Room  *Room
+	Text  string
+}
+
+//
+// Go code that reacts to events. o is the object that subscribed.
+//
+type EventHandler func(w *World, o Objecter, e Event)
+
+//
+// Have a Go handler called whenever an event of this kind happens in
+// the same room as the object, or in the object itself if it's a
+// room. Handlers are dropped when their object is destroyed.
+//
+func (w *World) Subscribe(o Objecter, kind string, h EventHandler) {
+	if w.subscribers == nil {
+		w.subscribers = make(map[int]map[string][]EventHandler)
+	}
+
+	byKind := w.subscribers[o.Key()]
+
+	if byKind == nil {
+		byKind = make(map[string][]EventHandler)
+		w.subscribers[o.Key()] = byKind
+	}
+
+	byKind[kind] = append(byKind[kind], h)
+}
+
+// Drop every handler the object has for this kind of event.
+func (w *World) Unsubscribe(o Objecter, kind string) {
+	delete(w.subscribers[o.Key()], kind)
+}
+
+//
+// Scripts react to events too, from attributes named for them, e.g.
+// ON-ENTER. They run with "me" as the player who set the event off,
+// and "args" as what was said.
+//
+func eventAttr(kind string) string {
+	return "ON-" + strings.ToUpper(kind)
+}
+
+// Every kind of event there is.
+var eventKinds = []string{EventEnter, EventLeave, EventSay, EventConnect, EventDisconnect}
+
+func isEventAttr(name string) bool {
+	for _, kind := range eventKinds {
+		if normalAttrName(name) == eventAttr(kind) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//
+// Tell everything in the event's room what happened: the room itself,
+// then the things in it, then the players, each in the order they
+// were created.
+//
+func (w *World) emit(e Event) {
+	if e.Room == nil || w.eventDepth >= maxEventDepth {
+		return
+	}
+
+	w.eventDepth++
+	defer func() { w.eventDepth-- }()
+
+	listeners := []Objecter{e.Room}
+
+	for _, t := range e.Room.Things() {
+		listeners = append(listeners, t)
+	}
+
+	players := make([]*Player, 0, len(e.Room.players))
+	for _, p := range e.Room.players {
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].key < players[j].key })
+
+	for _, p := range players {
+		listeners = append(listeners, p)
+	}
+
+	for _, o := range listeners {
+		for _, h := range w.subscribers[o.Key()][e.Kind] {
+			h(w, o, e)
+		}
+
+		w.runEventScript(o, e)
+	}
+}
+
+func (w *World) runEventScript(o Objecter, e Event) {
+	attr, exists := o.Attribute(eventAttr(e.Kind))
+
+	if !exists || e.Actor == nil || e.Actor.location == nil {
+		return
+	}
+
+	program, err := ParseScript(attr.Value)
+
+	if err == nil {
+		err = w.RunScript(program, e.Actor, o, e.Text)
+	}
+
+	if err != nil {
+		errorLog.Printf("%s on %s (#%d) failed: %s", attr.Name, o.Name(), o.Key(), err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMovePlayerEmitsLeaveAndEnter(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	rug, _ := world.NewThing("Rug", den)
+
+	var seen []string
+
+	record := func(w *World, o Objecter, e Event) {
+		seen = append(seen, o.Name()+" "+e.Kind+" "+e.Room.Name()+" "+e.Actor.Name())
+	}
+
+	world.Subscribe(hall, EventLeave, record)
+	world.Subscribe(hall, EventEnter, record)
+	world.Subscribe(rug, EventEnter, record)
+
+	world.MovePlayer(bob, den)
+
+	if len(seen) != 2 || seen[0] != "The Hall leave The Hall bob" || seen[1] != "Rug enter The Den bob" {
+		t.Errorf("Unexpected events %q", seen)
+	}
+
+	world.Unsubscribe(rug, EventEnter)
+	world.MovePlayer(bob, hall)
+
+	if len(seen) != 3 || seen[2] != "The Hall enter The Hall bob" {
+		t.Errorf("Unexpected events %q", seen)
+	}
+
+	// Moving to the room you're already in is no move at all.
+	world.MovePlayer(bob, hall)
+
+	if len(seen) != 3 {
+		t.Errorf("Expected no events for staying put, got %q", seen[3:])
+	}
+}
+
+func TestSpeechAndConnectionEvents(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("bob", "foo", hall)
+
+	var seen []Event
+
+	for _, kind := range []string{EventSay, EventConnect, EventDisconnect} {
+		world.Subscribe(hall, kind, func(w *World, o Objecter, e Event) { seen = append(seen, e) })
+	}
+
+	client := NewClient(NewMockConn())
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	doSay(world, client, Command{"say", "", "Hello"})
+	doEmote(world, client, Command{"emote", "", "waves."})
+	world.disconnectPlayer(client)
+
+	kinds := []string{EventConnect, EventSay, EventSay, EventDisconnect}
+
+	if len(seen) != len(kinds) {
+		t.Fatalf("Expected %d events, got %+v", len(kinds), seen)
+	}
+
+	for i, kind := range kinds {
+		if seen[i].Kind != kind || seen[i].Actor.name != "bob" {
+			t.Errorf("Expected event %d to be bob's %s, got %+v", i, kind, seen[i])
+		}
+	}
+
+	if seen[1].Text != "Hello" || seen[2].Text != "waves." {
+		t.Errorf("Expected speech events to carry what was said")
+	}
+}
+
+func TestEventScripts(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	parrot, _ := world.NewThing("Parrot", den)
+	world.SetOwner(parrot, bob)
+	world.SetAttribute(parrot, "on-enter", `(tell me "Squawk! Hello, " (name me) "!")`)
+	world.SetAttribute(parrot, "on-say", `(tell-others (name this) " squawks, \"" args "\"")`)
+
+	bobConn, jimConn := NewMockConn(), NewMockConn()
+	bobClient, jimClient := NewClient(bobConn), NewClient(jimConn)
+	world.NewPlayer("jim", "bar", den)
+	doConnect(world, bobClient, Command{"connect", "", "bob foo"})
+	doConnect(world, jimClient, Command{"connect", "", "jim bar"})
+
+	world.MovePlayer(bob, den)
+
+	assertMatch(t, "Squawk! Hello, bob!\r\n", bobConn.String())
+
+	doSay(world, jimClient, Command{"say", "", "Pieces of eight"})
+
+	assertMatch(t, "Parrot squawks, \"Pieces of eight\"\r\n", bobConn.String())
+}
+
+func TestOnlyProgrammersWriteEventScripts(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	world.SetOwner(hall, bob)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	doAttr(world, client, Command{"@attr", "here/on-enter", `(tell me "Hi.")`})
+
+	if _, exists := hall.Attribute("on-enter"); exists {
+		t.Errorf("Expected bob not to be able to write an event script")
+	}
+
+	assertMatch(t, "Only programmers can write programs.\r\n", conn.String())
+
+	// Data that merely looks like an event is just data.
+	doAttr(world, client, Command{"@attr", "here/on-sale", "yes"})
+
+	if a, _ := hall.Attribute("on-sale"); a.Value != "yes" {
+		t.Errorf("Expected bob to be able to set ON-SALE")
+	}
+}
+
+func TestEventsDontLoopForever(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+
+	calls := 0
+
+	// Whoever enters either room is sent straight to the other.
+	bounce := func(w *World, o Objecter, e Event) {
+		calls++
+		if e.Room == hall {
+			w.MovePlayer(e.Actor, den)
+		} else {
+			w.MovePlayer(e.Actor, hall)
+		}
+	}
+
+	world.Subscribe(hall, EventEnter, bounce)
+	world.Subscribe(den, EventEnter, bounce)
+
+	world.MovePlayer(bob, den)
+
+	if calls != maxEventDepth {
+		t.Errorf("Expected events to stop after %d levels, got %d", maxEventDepth, calls)
+	}
+}
+
+func TestDestroyDropsSubscriptions(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("bob", "foo", hall)
+	rug, _ := world.NewThing("Rug", hall)
+
+	world.Subscribe(rug, EventSay, func(w *World, o Objecter, e Event) {})
+	world.Destroy(rug)
+
+	if _, exists := world.subscribers[rug.key]; exists {
+		t.Errorf("Expected the rug's handlers to go with it")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+//
+// GMCP (Generic MUD Communication Protocol) carries structured data
+// alongside the text of the game, as "Package.Message <json>" inside
+// telnet subnegotiation on option 201. Clients use it to draw maps
+// and status bars.
+//
+
+type gmcpRoomInfo struct {
+	Num   int            `json:"num"`
+	Name  string         `json:"name"`
+	Exits map[string]int `json:"exits"`
+}
+
+type gmcpCharStatus struct {
+	Name     string `json:"name"`
+	Num      int    `json:"num"`
+	Location int    `json:"location"`
+}
+
+type gmcpHello struct {
+	Client  string `json:"client"`
+	Version string `json:"version"`
+}
+
+//
+// Send a GMCP message, if the client has turned GMCP on and says it
+// understands the message's package.
+//
+func (c *Client) SendGMCP(message string, data interface{}) {
+	if !c.telnet.Enabled(GMCP) || !c.supportsGMCP(message) || !c.roomForOutput() {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+
+	if err != nil {
+		errorLog.Println("Could not encode GMCP", message, err)
+		return
+	}
+
+	c.telnet.Subnegotiate(GMCP, []byte(message+" "+string(payload)))
+}
+
+// Core messages are always allowed. Anything else needs the client
+// to have listed its package in Core.Supports.
+func (c *Client) supportsGMCP(message string) bool {
+	pkg := strings.ToLower(strings.SplitN(message, ".", 2)[0])
+
+	if pkg == "core" {
+		return true
+	}
+
+	_, supported := c.gmcpSupports[pkg]
+	return supported
+}
+
+func (c *Client) sendRoomInfo(r *Room) {
+	info := gmcpRoomInfo{Num: r.key, Name: r.name, Exits: make(map[string]int)}
+
+	for _, exit := range r.exits {
+		if exit.destination != nil {
+			info.Exits[exit.DisplayName()] = exit.destination.key
+		}
+	}
+
+	c.SendGMCP("Room.Info", info)
+}
+
+func (c *Client) sendCharStatus() {
+	p := c.player
+
+	status := gmcpCharStatus{Name: p.name, Num: p.key}
+
+	if p.location != nil {
+		status.Location = p.location.key
+	}
+
+	c.SendGMCP("Char.Status", status)
+}
+
+func (c *Client) receiveGMCP(data []byte) {
+	message := string(data)
+	payload := ""
+
+	if i := strings.IndexByte(message, ' '); i >= 0 {
+		message, payload = message[:i], message[i+1:]
+	}
+
+	switch strings.ToLower(message) {
+	case "core.hello":
+		var hello gmcpHello
+		if err := json.Unmarshal([]byte(payload), &hello); err == nil {
+			c.gmcpClient = hello.Client
+			c.gmcpVersion = hello.Version
+		}
+
+	case "core.supports.set":
+		c.gmcpSupports = make(map[string]int)
+		c.addGMCPSupports(payload)
+
+	case "core.supports.add":
+		c.addGMCPSupports(payload)
+
+	case "core.supports.remove":
+		var packages []string
+		if err := json.Unmarshal([]byte(payload), &packages); err == nil {
+			for _, p := range packages {
+				pkg, _ := parseGMCPPackage(p)
+				delete(c.gmcpSupports, pkg)
+			}
+		}
+	}
+}
+
+func (c *Client) addGMCPSupports(payload string) {
+	var packages []string
+
+	if err := json.Unmarshal([]byte(payload), &packages); err != nil {
+		return
+	}
+
+	if c.gmcpSupports == nil {
+		c.gmcpSupports = make(map[string]int)
+	}
+
+	for _, p := range packages {
+		pkg, version := parseGMCPPackage(p)
+		c.gmcpSupports[pkg] = version
+	}
+}
+
+// Packages are listed as "Name Version", e.g. "Room 1". Names are not
+// case sensitive.
+func parseGMCPPackage(s string) (string, int) {
+	fields := strings.Fields(s)
+
+	if len(fields) == 0 {
+		return "", 0
+	}
+
+	version := 1
+
+	if len(fields) > 1 {
+		if v, err := strconv.Atoi(fields[1]); err == nil {
+			version = v
+		}
+	}
+
+	return strings.ToLower(fields[0]), version
+}
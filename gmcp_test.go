@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func gmcpMessage(s string) []byte {
+	msg := []byte{IAC, SB, GMCP}
+	msg = append(msg, []byte(s)...)
+	return append(msg, IAC, SE)
+}
+
+// Build a client that has agreed to GMCP and said what it supports.
+func newGMCPClient(supports string) (*Client, *MockConn) {
+	conn := NewMockConn()
+	client := NewClient(conn)
+
+	client.negotiate()
+
+	input := []byte{IAC, DO, GMCP}
+	input = append(input, gmcpMessage(`Core.Hello {"client":"Mudlet","version":"4.17"}`)...)
+	input = append(input, gmcpMessage("Core.Supports.Set "+supports)...)
+	input = append(input, "\r\n"...)
+
+	conn.readBytes = append(conn.readBytes, input)
+	readAllLines(client.telnet)
+	conn.writeBuffer.Reset()
+
+	return client, conn
+}
+
+func TestClientOffersGMCP(t *testing.T) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+	client := NewClient(conn)
+
+	client.negotiate()
+
+	if !bytes.Contains(conn.writeBuffer.Bytes(), []byte{IAC, WILL, GMCP}) {
+		t.Errorf("Expected the server to offer GMCP")
+	}
+}
+
+func TestGMCPCoreHello(t *testing.T) {
+	client, _ := newGMCPClient(`["Room 1"]`)
+
+	if client.gmcpClient != "Mudlet" || client.gmcpVersion != "4.17" {
+		t.Errorf("Expected Core.Hello to be recorded, got %s %s", client.gmcpClient, client.gmcpVersion)
+	}
+}
+
+func TestGMCPCoreSupports(t *testing.T) {
+	client, _ := newGMCPClient(`["Room 1", "Char 2"]`)
+
+	if client.gmcpSupports["room"] != 1 || client.gmcpSupports["char"] != 2 {
+		t.Errorf("Expected Room and Char to be supported, got %v", client.gmcpSupports)
+	}
+
+	client.receiveGMCP([]byte(`Core.Supports.Remove ["Room"]`))
+	client.receiveGMCP([]byte(`Core.Supports.Add ["Comm.Channel 1"]`))
+
+	if _, exists := client.gmcpSupports["room"]; exists {
+		t.Errorf("Expected Room to have been removed")
+	}
+
+	if client.gmcpSupports["comm.channel"] != 1 {
+		t.Errorf("Expected Comm.Channel to have been added")
+	}
+}
+
+func TestGMCPSendsStatusAndRoomOnConnect(t *testing.T) {
+	client, conn := newGMCPClient(`["Room 1", "Char 1"]`)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	world.NewExit(hall, "east", den)
+	world.NewPlayer("bob", "foo", hall)
+
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	output := conn.writeBuffer.Bytes()
+
+	if !bytes.Contains(output, gmcpMessage(`Char.Status {"name":"bob","num":4,"location":1}`)) {
+		t.Errorf("Expected Char.Status to be sent, got %q", output)
+	}
+
+	if !bytes.Contains(output, gmcpMessage(`Room.Info {"num":1,"name":"The Hall","exits":{"east":2}}`)) {
+		t.Errorf("Expected Room.Info to be sent, got %q", output)
+	}
+}
+
+func TestGMCPSendsRoomInfoOnMove(t *testing.T) {
+	client, conn := newGMCPClient(`["Room 1"]`)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	world.NewExit(hall, "east", den)
+	world.NewExit(den, "west", hall)
+	world.NewPlayer("bob", "foo", hall)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	conn.writeBuffer.Reset()
+
+	doMove(world, client, Command{"move", "east", ""})
+
+	expected := gmcpMessage(`Room.Info {"num":2,"name":"The Den","exits":{"west":1}}`)
+
+	if !bytes.Contains(conn.writeBuffer.Bytes(), expected) {
+		t.Errorf("Expected Room.Info to be sent, got %q", conn.String())
+	}
+}
+
+func TestGMCPOnlySendsSupportedPackages(t *testing.T) {
+	client, conn := newGMCPClient(`["Char 1"]`)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("bob", "foo", hall)
+
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	if strings.Contains(conn.String(), "Room.Info") {
+		t.Errorf("Expected no Room.Info for a client that doesn't support it")
+	}
+}
+
+func TestGMCPIsSilentUntilNegotiated(t *testing.T) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+	client := NewClient(conn)
+	client.gmcpSupports = map[string]int{"room": 1}
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+
+	client.sendRoomInfo(hall)
+
+	if conn.writeBuffer.Len() != 0 {
+		t.Errorf("Expected nothing to be sent, got %q", conn.String())
+	}
+}
+
+func TestSubnegotiateEscapesIAC(t *testing.T) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+	telnet := NewTelnet(conn)
+
+	telnet.Subnegotiate(GMCP, []byte("a\xffb"))
+
+	expected := []byte{IAC, SB, GMCP, 'a', IAC, IAC, 'b', IAC, SE}
+
+	if !bytes.Equal(conn.writeBuffer.Bytes(), expected) {
+		t.Errorf("Expected %v, got %v", expected, conn.writeBuffer.Bytes())
+	}
+}
@@ -0,0 +1,7 @@
+module github.com/sethm/gomud
+
+go 1.25.0
+
+require golang.org/x/crypto v0.54.0
+
+require golang.org/x/sys v0.47.0 // indirect
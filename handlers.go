@@ -1,47 +1,255 @@
 package main
 
 import (
-	"crypto/sha512"
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //
 // Handlers
 //
 
+func doAddKey(world *World, client *Client, cmd Command) {
+	if cmd.args == "" {
+		client.Tell("Try: @addkey <public key>")
+		return
+	}
+
+	key, err := parsePublicKey(cmd.args)
+
+	if err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	if client.player.HasPublicKey(key) {
+		client.Tell("You already have that key.")
+		return
+	}
+
+	world.AddPublicKey(client.player, key)
+	client.Tell("Key added: %s", keyFingerprint(key))
+}
+
+//
+// Set an attribute with "@attr <object>/<attr>=<value>", or clear it
+// by leaving out the value. "&<attr> <object>=<value>" is rewritten
+// to this by parseCommand.
+//
+func doAttr(world *World, client *Client, cmd Command) {
+	target, name := findAttrTarget(world, client, cmd.target)
+
+	if target == nil {
+		return
+	}
+
+	if !canSetAttr(client.player, target, name) {
+		client.Tell("You can't do that.")
+		return
+	}
+
+	if isProgramAttr(name) && cmd.args != "" {
+		if !client.player.IsSet(ProgrammerFlag) && !client.player.IsSet(WizardFlag) {
+			client.Tell("Only programmers can write programs.")
+			return
+		}
+
+		if _, err := ParseScript(cmd.args); err != nil {
+			client.Tell("%s", err)
+			return
+		}
+	}
+
+	if cmd.args == "" {
+		world.ClearAttribute(target, name)
+		client.Tell("Cleared.")
+		return
+	}
+
+	world.SetAttribute(target, name, cmd.args)
+	client.Tell("Set.")
+}
+
+func doAttrFlag(world *World, client *Client, cmd Command) {
+	target, name := findAttrTarget(world, client, cmd.target)
+
+	if target == nil {
+		return
+	}
+
+	attr, exists := target.Attribute(name)
+
+	if !exists || !canSeeAttr(client.player, target, attr) {
+		client.Tell("%s has no attribute %s.", target.Name(), normalAttrName(name))
+		return
+	}
+
+	clear := strings.HasPrefix(cmd.args, "!")
+	flag, err := ParseAttrFlag(strings.TrimPrefix(cmd.args, "!"))
+
+	if err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	// Only wizards may hide attributes from mortals, or lock them
+	// against their owners.
+	if !canSetAttr(client.player, target, name) ||
+		(flag != AttrVisible && !client.player.IsSet(WizardFlag)) {
+		client.Tell("You can't do that.")
+		return
+	}
+
+	if clear {
+		world.SetAttributeFlags(target, name, attr.Flags&^flag)
+	} else {
+		world.SetAttributeFlags(target, name, attr.Flags|flag)
+	}
+
+	client.Tell("Flags set.")
+}
+
+func doClear(world *World, client *Client, cmd Command) {
+	doAttr(world, client, Command{verb: cmd.verb, target: cmd.target})
+}
+
 func doConnect(world *World, client *Client, cmd Command) {
 
+	if !canSendPassword(client) {
+		return
+	}
+
 	nameAndPass := strings.SplitN(cmd.args, " ", 2)
 
-	if len(nameAndPass) < 2 {
+	if cmd.args == "" {
 		client.Tell("Try: connect <player> <password>")
 		return
 	}
 
-	normalName := strings.ToLower(nameAndPass[0])
-	passwordHash := sha512.Sum512([]byte(nameAndPass[1]))
+	// No password given, so ask for one without echoing it back.
+	if len(nameAndPass) < 2 {
+		client.EchoOff()
+		client.Prompt("Password:", func(password string) {
+			client.EchoOn()
+			client.Tell("")
+			doConnect(world, client, Command{"connect", "", cmd.args + " " + password})
+		})
+		return
+	}
 
-	for _, player := range world.players {
-		if player.normalName == normalName {
-			if player.password != passwordHash {
-				client.Tell("Incorrect password.")
-				return
-			}
-
-			// Is the player already connected?
-			if player.client != nil {
-				client.Tell("Already connected!")
-				return
-			}
-
-			world.connectPlayer(client, player)
+	player := world.FindPlayer(nameAndPass[0])
+
+	if player == nil {
+		client.Tell("No such player!")
+		return
+	}
+
+	// Checking the password is slow, so it's done off the world's
+	// goroutine.
+	stored := player.password
+	var ok bool
+	var upgraded string
+
+	world.offloadFor(client, func() {
+		ok, upgraded = checkPassword(stored, nameAndPass[1])
+	}, func(world *World) {
+		if !ok {
+			client.Tell("Incorrect password.")
+			return
+		}
+
+		// Is the player already connected?
+		if player.client != nil {
+			client.Tell("Already connected!")
 			return
 		}
+
+		world.UpgradePassword(player, stored, upgraded)
+		world.connectPlayer(client, player)
+	})
+}
+
+func doContainer(world *World, client *Client, cmd Command) {
+	target, err := world.FindTarget(client, cmd)
+	thing, isThing := target.(*Thing)
+
+	if err != nil || !isThing {
+		client.Tell("I don't see that here.")
+		return
 	}
 
-	client.Tell("No such player!")
-	return
+	if !controls(client.player, thing) {
+		client.Tell("You can't do that.")
+		return
+	}
+
+	if cmd.args == "off" {
+		world.ClearFlag(thing, ContainerFlag)
+		client.Tell("%s is no longer a container.", thing.name)
+		return
+	}
+
+	capacity, err := strconv.Atoi(cmd.args)
+
+	if cmd.args == "" {
+		capacity, err = 0, nil
+	}
+
+	if err != nil || capacity < 0 {
+		client.Tell("Try: @container <thing>=<capacity>, or <thing>=off")
+		return
+	}
+
+	world.SetFlag(thing, ContainerFlag)
+	world.SetCapacity(thing, capacity)
+
+	if capacity == 0 {
+		client.Tell("%s is now a container.", thing.name)
+	} else {
+		client.Tell("%s is now a container holding up to %d things.", thing.name, capacity)
+	}
+}
+
+func doCreate(world *World, client *Client, cmd Command) {
+	name := strings.TrimSpace(cmd.args)
+
+	if !hasBuildPermission(client.player) {
+		client.Tell("Sorry, you don't have permission to do that.")
+		return
+	}
+
+	if name == "" {
+		client.Tell("Create what?")
+		return
+	}
+
+	thing, err := world.NewThing(name, client.player)
+
+	if err != nil {
+		client.Tell("You can't do that!")
+		return
+	}
+
+	world.SetOwner(thing, client.player)
+
+	client.Tell("Created %s (#%d).", thing.name, thing.key)
+}
+
+func doDelKey(world *World, client *Client, cmd Command) {
+	keys := client.player.publicKeys
+	n, err := strconv.Atoi(cmd.args)
+
+	if err != nil || n < 1 || n > len(keys) {
+		client.Tell("Try: @delkey <number>, as listed by @keys")
+		return
+	}
+
+	key := keys[n-1]
+	world.RemovePublicKey(client.player, key)
+	client.Tell("Key removed: %s", keyFingerprint(key))
 }
 
 func doDesc(world *World, client *Client, cmd Command) {
@@ -59,17 +267,55 @@ func doDesc(world *World, client *Client, cmd Command) {
 		return
 	}
 
-	target.SetDescription(desc)
+	world.SetDescription(target, desc)
 	client.Tell("Description set.")
 	return
 }
 
+func doDestroy(world *World, client *Client, cmd Command) {
+	var target Objecter
+	var err error
+
+	// Rooms are usually somewhere else, so allow them by number.
+	if strings.HasPrefix(cmd.target, "#") {
+		key, _ := strconv.Atoi(cmd.target[1:])
+		target, _ = world.object(key)
+	} else {
+		target, err = world.FindTarget(client, cmd)
+	}
+
+	if err != nil || target == nil {
+		client.Tell("I don't see that here.")
+		return
+	}
+
+	if !controls(client.player, target) {
+		client.Tell("You can't do that.")
+		return
+	}
+
+	name, key := target.Name(), target.Key()
+
+	if err = world.Destroy(target); err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	client.Tell("Destroyed %s (#%d).", name, key)
+}
+
+//
+// Dig a new room, with an exit to it from here. Given a second exit
+// name after a comma, as in "@dig north;n,south;s=Hallway", also dig
+// the exit back. "@dig/tel" takes the builder into the new room.
+//
 func doDig(world *World, client *Client, cmd Command) {
-	here := client.player.location
-	exitName := cmd.target
+	player := client.player
+	here := player.location
+	exitName, returnName, hasReturn := strings.Cut(cmd.target, ",")
 	roomName := cmd.args
 
-	if !hasBuildPermission(client.player) {
+	if !hasBuildPermission(player) {
 		client.Tell("Sorry, you don't have permission to do that.")
 		return
 	}
@@ -79,6 +325,19 @@ func doDig(world *World, client *Client, cmd Command) {
 		return
 	}
 
+	if err := here.CheckExitName(exitName); err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	// The new room has no exits yet, so this only checks the name.
+	if hasReturn {
+		if err := new(Room).CheckExitName(returnName); err != nil {
+			client.Tell("%s", err)
+			return
+		}
+	}
+
 	room, err := world.NewRoom(roomName)
 
 	if err != nil {
@@ -88,16 +347,51 @@ func doDig(world *World, client *Client, cmd Command) {
 
 	exit, _ := world.NewExit(here, exitName, room)
 
-	room.SetOwner(client.player)
-	exit.SetOwner(client.player)
+	world.SetOwner(room, player)
+	world.SetOwner(exit, player)
+
+	if hasReturn {
+		back, _ := world.NewExit(room, returnName, here)
+		world.SetOwner(back, player)
+	}
 
 	client.Tell("Dug.")
+
+	if cmd.verb == "@dig/tel" {
+		world.MovePlayer(player, room)
+		client.lookAt(room)
+	}
+}
+
+func doDrop(world *World, client *Client, cmd Command) {
+	player := client.player
+
+	if cmd.target == "" {
+		client.Tell("Drop what?")
+		return
+	}
+
+	thing := player.FindThing(cmd.target)
+
+	if thing == nil {
+		client.Tell("You aren't carrying that.")
+		return
+	}
+
+	if err := world.MoveThing(thing, player.location); err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	client.Tell("Dropped.")
+	world.TellAllButMe(player, "%s drops %s.", player.name, thing.name)
 }
 
 func doEmote(world *World, client *Client, cmd Command) {
 	player := client.player
-	client.Tell(player.name + " " + cmd.args)
-	world.TellAllButMe(player, player.name+" "+cmd.args)
+	client.Tell("%s %s", player.name, cmd.args)
+	world.TellAllButMe(player, "%s %s", player.name, cmd.args)
+	world.emit(Event{Kind: EventSay, Actor: player, Room: player.location, Text: cmd.args})
 }
 
 func doExamine(world *World, client *Client, cmd Command) {
@@ -111,6 +405,134 @@ func doExamine(world *World, client *Client, cmd Command) {
 	client.examine(target)
 }
 
+func doFail(world *World, client *Client, cmd Command) {
+	target, err := world.FindTarget(client, cmd)
+
+	if err != nil {
+		client.Tell("I don't see that here.")
+		return
+	}
+
+	if !controls(client.player, target) {
+		client.Tell("You can't do that.")
+		return
+	}
+
+	world.SetFailMessage(target, cmd.args)
+
+	if cmd.args == "" {
+		client.Tell("Failure message cleared.")
+	} else {
+		client.Tell("Failure message set.")
+	}
+}
+
+func doGet(world *World, client *Client, cmd Command) {
+	player := client.player
+
+	if cmd.target == "" {
+		client.Tell("Get what?")
+		return
+	}
+
+	// get <thing> from <container>
+	if i := strings.LastIndex(strings.ToLower(cmd.target), " from "); i >= 0 {
+		doGetFrom(world, client, cmd.target[:i], cmd.target[i+len(" from "):])
+		return
+	}
+
+	thing := player.location.FindThing(cmd.target)
+
+	if thing == nil {
+		client.Tell("I don't see that here.")
+		return
+	}
+
+	if err := world.TakeThing(player, thing); err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	client.Tell("Taken.")
+	world.TellAllButMe(player, "%s picks up %s.", player.name, thing.name)
+}
+
+func doGetFrom(world *World, client *Client, thingName string, containerName string) {
+	player := client.player
+	container := findContainer(client, containerName)
+
+	if container == nil {
+		return
+	}
+
+	thing := container.FindThing(strings.TrimSpace(thingName))
+
+	if thing == nil {
+		client.Tell("There's no %s in %s.", strings.TrimSpace(thingName), container.name)
+		return
+	}
+
+	if err := world.TakeThing(player, thing); err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	client.Tell("You take %s from %s.", thing.name, container.name)
+	world.TellAllButMe(player, "%s takes %s from %s.", player.name, thing.name, container.name)
+}
+
+func doGetAttr(world *World, client *Client, cmd Command) {
+	target, name := findAttrTarget(world, client, cmd.target)
+
+	if target == nil {
+		return
+	}
+
+	attr, exists := target.Attribute(name)
+
+	if !exists || !canSeeAttr(client.player, target, attr) {
+		client.Tell("%s has no attribute %s.", target.Name(), normalAttrName(name))
+		return
+	}
+
+	client.Tell("%s", attr.Value)
+}
+
+func doGive(world *World, client *Client, cmd Command) {
+	player := client.player
+
+	if cmd.target == "" || cmd.args == "" {
+		client.Tell("Try: give <player>=<thing>")
+		return
+	}
+
+	target, err := world.FindTarget(client, Command{target: cmd.target})
+	recipient, isPlayer := target.(*Player)
+
+	if err != nil || !isPlayer {
+		client.Tell("I don't see them here.")
+		return
+	}
+
+	thing := player.FindThing(cmd.args)
+
+	if thing == nil {
+		client.Tell("You aren't carrying that.")
+		return
+	}
+
+	if err := world.MoveThing(thing, recipient); err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	client.Tell("You give %s to %s.", thing.name, recipient.name)
+
+	if recipient.client != nil {
+		recipient.client.Tell("%s gives you %s.", player.name, thing.name)
+	}
+}
+
 func doHelp(world *World, client *Client, cmd Command) {
 	client.Tell("Welcome to this experimental MUD!")
 	client.Tell("")
@@ -118,12 +540,72 @@ func doHelp(world *World, client *Client, cmd Command) {
 	client.Tell("   go <exit>                   Move to a new room")
 	client.Tell("   <direction>                 Move to a new room")
 	client.Tell("   @dig <exit>=<name>          Dig a new room")
+	client.Tell("   @dig <exit>,<back>=<name>   Dig a new room and the way back")
+	client.Tell("   @dig/tel <exit>=<name>      Dig a new room and go there")
 	client.Tell("   @link <exit>=<room_number>  Create a new exit to room #")
+	client.Tell("                               (name exits like north;n to")
+	client.Tell("                               give them aliases)")
+	client.Tell("   @create <name>              Create a new thing")
+	client.Tell("   @destroy <thing>|#<number>  Destroy something you own")
+	client.Tell("   @lock <thing>=<lock>        Lock a thing, e.g. wizard|#12&!#34")
+	client.Tell("   @unlock <thing>             Remove a thing's lock")
+	client.Tell("   @fail <thing>=<message>     Say why the lock stopped someone")
+	client.Tell("   &<attr> <thing>=<value>     Set an attribute on a thing")
+	client.Tell("   @get <thing>/<attr>         Show an attribute")
+	client.Tell("   @clear <thing>/<attr>       Clear an attribute")
+	client.Tell("   @aflag <thing>/<attr>=<flag> Flag it visible, wizard or locked")
+	client.Tell("   &$<verb> <thing>=<program>  Program a verb (programmers only)")
+	client.Tell("   &on-<event> <thing>=<prog>  React to enter, leave, say, connect")
+	client.Tell("                               or disconnect")
+	client.Tell("   @succ <exit>=<message>      Tell players who take an exit")
+	client.Tell("   @leave <exit>=<message>     Tell the room they leave (%%n is")
+	client.Tell("   @arrive <exit>=<message>    the player), or where they arrive")
+	client.Tell("   get <thing>, drop <thing>   Pick up or put down a thing")
+	client.Tell("   give <player>=<thing>       Give a thing to another player")
+	client.Tell("   put <thing> in <container>  Put a thing in a container")
+	client.Tell("   get <thing> from <cont...>  Take a thing out of a container")
+	client.Tell("   open <thing>, close <thing> Open or close a container")
+	client.Tell("   inventory                   See what you're carrying")
+	client.Tell("   @addkey <public key>        Add an SSH key for logging in")
+	client.Tell("   @keys                       List your SSH keys")
+	client.Tell("   @delkey <number>            Remove one of your SSH keys")
+	client.Tell("   who                         See who's connected")
+	client.Tell("   tell <player>=<message>     Send a private message")
+	client.Tell("   reply <message>             Reply to the last private message")
+	client.Tell("   width <columns>             Set your screen width")
 	client.Tell("   quit                        Leave the game")
 	client.Tell("")
 	client.Tell("")
 }
 
+func doInventory(world *World, client *Client, cmd Command) {
+	things := client.player.Things()
+
+	if len(things) == 0 {
+		client.Tell("You aren't carrying anything.")
+		return
+	}
+
+	client.Tell("You are carrying:")
+	for _, t := range things {
+		client.Tell("  %s", t.name)
+	}
+}
+
+func doKeys(world *World, client *Client, cmd Command) {
+	keys := client.player.publicKeys
+
+	if len(keys) == 0 {
+		client.Tell("You have no keys. Add one with @addkey <public key>.")
+		return
+	}
+
+	client.Tell("Your keys:")
+	for i, key := range keys {
+		client.Tell("  %d. %s %s", i+1, strings.Fields(key)[0], keyFingerprint(key))
+	}
+}
+
 func doLink(world *World, client *Client, cmd Command) {
 	here := client.player.location
 	exitName := cmd.target
@@ -146,7 +628,10 @@ func doLink(world *World, client *Client, cmd Command) {
 		return
 	}
 
-	world.NewExit(here, exitName, room)
+	if _, err = world.NewExit(here, exitName, room); err != nil {
+		client.Tell("%s", err)
+		return
+	}
 
 	client.Tell("Linked.")
 }
@@ -162,26 +647,67 @@ func doLook(world *World, client *Client, cmd Command) {
 	client.lookAt(target)
 }
 
+func doLock(world *World, client *Client, cmd Command) {
+	target, err := world.FindTarget(client, cmd)
+
+	if err != nil {
+		client.Tell("I don't see that here.")
+		return
+	}
+
+	if !controls(client.player, target) {
+		client.Tell("You can't do that.")
+		return
+	}
+
+	if strings.TrimSpace(cmd.args) == "" {
+		client.Tell("Lock it to what?")
+		return
+	}
+
+	lock, err := ParseLock(cmd.args)
+
+	if err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	world.SetLock(target, lock)
+	client.Tell("Locked.")
+}
+
 func doMove(world *World, client *Client, cmd Command) {
 	player := client.player
 	here := player.location
 
-	normalName := strings.ToLower(cmd.target)
+	exit := here.FindExit(cmd.target)
 
-	// Try to find an exit with the correct name.
-	for _, exit := range here.exits {
-		if exit.normalName == normalName {
-			world.MovePlayer(player, exit.destination)
-			client.lookAt(player.location)
-			return
-		}
+	if exit == nil {
+		client.Tell("There's no exit in that direction!")
+		return
 	}
 
-	client.Tell("There's no exit in that direction!")
+	if _, err := world.UseExit(player, exit); err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	here.Tell("%s", exit.messageFor(LeaveMessage, player))
+
+	if msg := exit.messageFor(SuccessMessage, player); msg != "" {
+		client.Tell("%s", msg)
+	}
+
+	world.TellAllButMe(player, "%s", exit.messageFor(ArriveMessage, player))
+	client.lookAt(player.location)
 }
 
 func doNewplayer(world *World, client *Client, cmd Command) {
 
+	if !canSendPassword(client) {
+		return
+	}
+
 	if cmd.target == "" || cmd.args == "" {
 		client.Tell("Try: newplayer <player> <password>")
 		return
@@ -198,30 +724,131 @@ func doNewplayer(world *World, client *Client, cmd Command) {
 
 	// Ugh, what a kludge. Need a proper framework for defining
 	// player creation room
-	startingRoom, exists := world.rooms[1]
+	startingRoom, exists := world.rooms[START_ROOM]
 	if !exists {
 		client.Tell("Sorry, we can't create any players right now.")
 		return
 	}
 
-	player, err := world.NewPlayer(cmd.target, cmd.args, startingRoom)
+	var hash string
+	var hashErr error
 
-	if err != nil {
-		client.Tell("Sorry, we can't create any players right now.")
+	world.offloadFor(client, func() {
+		hash, hashErr = hashPassword(cmd.args)
+	}, func(world *World) {
+		if hashErr != nil {
+			client.Tell("Sorry, we can't create any players right now.")
+			return
+		}
+
+		// Someone may have taken the name while we were hashing.
+		player, err := world.NewPlayerWithHash(cmd.target, hash, startingRoom)
+
+		if err != nil {
+			client.Tell("Sorry, that name is in use.")
+			return
+		}
+
+		world.connectPlayer(client, player)
+	})
+}
+
+func doOpen(world *World, client *Client, cmd Command) {
+	setOpen(world, client, cmd.target, true)
+}
+
+func doClose(world *World, client *Client, cmd Command) {
+	setOpen(world, client, cmd.target, false)
+}
+
+func setOpen(world *World, client *Client, name string, open bool) {
+	player := client.player
+	thing := player.FindThing(name)
+
+	if thing == nil {
+		thing = player.location.FindThing(name)
+	}
+
+	if thing == nil || !thing.IsContainer() {
+		client.Tell("You can't open or close that.")
+		return
+	}
+
+	if thing.IsOpen() == open {
+		if open {
+			client.Tell("It's already open.")
+		} else {
+			client.Tell("It's already closed.")
+		}
 		return
 	}
 
-	world.connectPlayer(client, player)
+	if open {
+		world.ClearFlag(thing, ClosedFlag)
+		client.Tell("You open %s.", thing.name)
+		world.TellAllButMe(player, "%s opens %s.", player.name, thing.name)
+	} else {
+		world.SetFlag(thing, ClosedFlag)
+		client.Tell("You close %s.", thing.name)
+		world.TellAllButMe(player, "%s closes %s.", player.name, thing.name)
+	}
+}
+
+func doPut(world *World, client *Client, cmd Command) {
+	player := client.player
+	i := strings.LastIndex(strings.ToLower(cmd.args), " in ")
+
+	if i < 0 {
+		client.Tell("Try: put <thing> in <container>")
+		return
+	}
+
+	thingName := strings.TrimSpace(cmd.args[:i])
+	thing := player.FindThing(thingName)
+
+	if thing == nil {
+		client.Tell("You aren't carrying that.")
+		return
+	}
+
+	container := findContainer(client, cmd.args[i+len(" in "):])
+
+	if container == nil {
+		return
+	}
+
+	if err := world.MoveThing(thing, container); err != nil {
+		client.Tell("%s", err)
+		return
+	}
+
+	client.Tell("You put %s in %s.", thing.name, container.name)
+	world.TellAllButMe(player, "%s puts %s in %s.", player.name, thing.name, container.name)
 }
 
 func doQuit(world *World, client *Client, cmd Command) {
 	client.quitRequested = true
 }
 
+func doReply(world *World, client *Client, cmd Command) {
+	if client.replyTo == nil {
+		client.Tell("Nobody has told you anything to reply to.")
+		return
+	}
+
+	if cmd.args == "" {
+		client.Tell("Try: reply <message>")
+		return
+	}
+
+	sendTell(client, client.replyTo, cmd.args)
+}
+
 func doSay(world *World, client *Client, cmd Command) {
 	player := client.player
-	client.Tell("You say, \"" + cmd.args + "\"")
-	world.TellAllButMe(player, player.name+" says, \""+cmd.args+"\"")
+	client.Tell("You say, \"%s\"", cmd.args)
+	world.TellAllButMe(player, "%s says, \"%s\"", player.name, cmd.args)
+	world.emit(Event{Kind: EventSay, Actor: player, Room: player.location, Text: cmd.args})
 }
 
 func doSet(world *World, client *Client, cmd Command) {
@@ -252,21 +879,175 @@ func doSet(world *World, client *Client, cmd Command) {
 	switch flagName {
 	case "builder":
 		if isUnset {
-			target.SetFlag(BuilderFlag)
+			world.SetFlag(target, BuilderFlag)
 		} else {
-			target.ClearFlag(BuilderFlag)
+			world.ClearFlag(target, BuilderFlag)
 		}
 	case "wizard":
 		if isUnset {
-			target.SetFlag(WizardFlag)
+			world.SetFlag(target, WizardFlag)
 		} else {
-			target.ClearFlag(WizardFlag)
+			world.ClearFlag(target, WizardFlag)
+		}
+	case "hidden":
+		if isUnset {
+			world.SetFlag(target, HiddenFlag)
+		} else {
+			world.ClearFlag(target, HiddenFlag)
+		}
+	case "programmer":
+		if isUnset {
+			world.SetFlag(target, ProgrammerFlag)
+		} else {
+			world.ClearFlag(target, ProgrammerFlag)
 		}
 	default:
 		client.Tell("I don't know that flag.")
 	}
 }
 
+func doSucc(world *World, client *Client, cmd Command) {
+	setExitMessage(world, client, cmd, SuccessMessage)
+}
+
+func doLeave(world *World, client *Client, cmd Command) {
+	setExitMessage(world, client, cmd, LeaveMessage)
+}
+
+func doArrive(world *World, client *Client, cmd Command) {
+	setExitMessage(world, client, cmd, ArriveMessage)
+}
+
+func setExitMessage(world *World, client *Client, cmd Command, kind string) {
+	target, err := world.FindTarget(client, cmd)
+
+	if err != nil {
+		client.Tell("I don't see that here.")
+		return
+	}
+
+	exit, isExit := target.(*Exit)
+
+	if !isExit {
+		client.Tell("%s isn't an exit.", target.Name())
+		return
+	}
+
+	if !controls(client.player, exit) {
+		client.Tell("You can't do that.")
+		return
+	}
+
+	world.SetExitMessage(exit, kind, cmd.args)
+
+	if cmd.args == "" {
+		client.Tell("Message cleared.")
+	} else {
+		client.Tell("Message set.")
+	}
+}
+
 func doTell(world *World, client *Client, cmd Command) {
-	client.Tell("Not Implemented Yet.")
+	name := strings.TrimSpace(cmd.target)
+
+	if name == "" || cmd.args == "" {
+		client.Tell("Try: tell <player>=<message>")
+		return
+	}
+
+	target := world.FindPlayer(name)
+
+	if target == nil {
+		client.Tell("I don't know anyone called %s.", name)
+		return
+	}
+
+	sendTell(client, target, cmd.args)
+}
+
+// Remove an object's lock.
+func doUnlock(world *World, client *Client, cmd Command) {
+	target, err := world.FindTarget(client, cmd)
+
+	if err != nil {
+		client.Tell("I don't see that here.")
+		return
+	}
+
+	if !controls(client.player, target) {
+		client.Tell("You can't do that.")
+		return
+	}
+
+	world.SetLock(target, nil)
+	client.Tell("Unlocked.")
+}
+
+//
+// List everyone who's connected. Wizards also see where players are
+// and where they're connecting from, and can hide themselves from
+// everyone else.
+//
+func doWho(world *World, client *Client, cmd Command) {
+	wizard := client.player.IsSet(WizardFlag)
+	now := time.Now()
+
+	var players []*Player
+
+	for _, p := range world.players {
+		if p.client == nil || (p.IsSet(HiddenFlag) && !wizard && p != client.player) {
+			continue
+		}
+		players = append(players, p)
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].normalName < players[j].normalName
+	})
+
+	if wizard {
+		client.Tell("%-16s %9s %5s  %-24s %s", "Player", "On For", "Idle", "Location", "Address")
+	} else {
+		client.Tell("%-16s %9s %5s", "Player", "On For", "Idle")
+	}
+
+	for _, p := range players {
+		name := p.name
+		if p.IsSet(HiddenFlag) {
+			name += " (hidden)"
+		}
+
+		onFor := formatOnFor(now.Sub(p.client.connectedAt))
+		idle := formatIdle(now.Sub(p.client.lastInput))
+
+		if wizard {
+			location := fmt.Sprintf("%s (#%d)", p.location.name, p.location.key)
+			client.Tell("%-16s %9s %5s  %-24s %s", name, onFor, idle, location, p.client.conn.RemoteAddr())
+		} else {
+			client.Tell("%-16s %9s %5s", name, onFor, idle)
+		}
+	}
+
+	if len(players) == 1 {
+		client.Tell("One player is connected.")
+	} else {
+		client.Tell("%d players are connected.", len(players))
+	}
+}
+
+func doWidth(world *World, client *Client, cmd Command) {
+	if cmd.args == "" {
+		client.Tell("Your screen is %d characters wide.", client.width)
+		return
+	}
+
+	width, err := strconv.Atoi(cmd.args)
+
+	if err != nil || width < MIN_WIDTH || width > MAX_WIDTH {
+		client.Tell("Try: width <%d-%d>", MIN_WIDTH, MAX_WIDTH)
+		return
+	}
+
+	client.width = width
+	client.Tell("Screen width set to %d.", width)
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDoConnectShouldWakeUpPlayers(t *testing.T) {
@@ -67,7 +69,7 @@ func TestDoConnectDoesNothingIfPlayerNotFound(t *testing.T) {
 	}
 }
 
-func TestDoConnectWithoutPasswordFails(t *testing.T) {
+func TestDoConnectWithoutPasswordPrompts(t *testing.T) {
 	conn := NewMockConn()
 	client := NewClient(conn)
 	world := NewWorld()
@@ -76,10 +78,22 @@ func TestDoConnectWithoutPasswordFails(t *testing.T) {
 
 	doConnect(world, client, Command{"connect", "", "bob"})
 
-	assertMatch(t, "Try: connect <player> <password>\r\n", conn.String())
+	if !strings.Contains(conn.String(), "\xff\xfb\x01Password:\r\n") {
+		t.Errorf("Expected a password prompt with echo turned off.")
+	}
 
-	if bob.awake {
-		t.Errorf("Bob should still be asleep.")
+	if bob.awake || client.prompt == nil {
+		t.Fatalf("Bob should still be asleep, waiting for a password.")
+	}
+
+	client.prompt("foo")
+
+	if !strings.Contains(conn.String(), "\xff\xfc\x01") {
+		t.Errorf("Expected echo to be turned back on.")
+	}
+
+	if !bob.awake || client.player != bob {
+		t.Errorf("Bob should have been connected by the password.")
 	}
 }
 
@@ -278,6 +292,72 @@ func TestDoDigSetsOwnershipOfNewRoom(t *testing.T) {
 	}
 }
 
+func TestDoDigCreatesReturnExit(t *testing.T) {
+	world := NewWorld()
+	conn := NewMockConn()
+	client := NewClient(conn)
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	bob.SetFlag(BuilderFlag)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	cmd, _ := parseCommand(client, "@dig north;n,south;s=Hallway")
+	doDig(world, client, cmd)
+
+	north := hall.FindExit("n")
+
+	if north == nil || north.destination == nil || north.destination.name != "Hallway" {
+		t.Fatalf("Expected an exit north to the hallway")
+	}
+
+	back := north.destination.FindExit("s")
+
+	if back == nil || back.destination != hall || back.owner != bob {
+		t.Errorf("Expected bob to own an exit back south to the hall")
+	}
+
+	if bob.location != hall {
+		t.Errorf("Expected bob to stay in the hall")
+	}
+}
+
+func TestDoDigRefusesEmptyReturnExit(t *testing.T) {
+	world := NewWorld()
+	conn := NewMockConn()
+	client := NewClient(conn)
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	bob.SetFlag(BuilderFlag)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	doDig(world, client, Command{"@dig", "north,", "Hallway"})
+
+	if len(world.rooms) != 1 || len(world.exits) != 0 {
+		t.Errorf("Expected nothing to be dug")
+	}
+
+	assertMatch(t, "Exits must have a name.\r\n", conn.String())
+}
+
+func TestDoDigTeleportsBuilder(t *testing.T) {
+	world := NewWorld()
+	conn := NewMockConn()
+	client := NewClient(conn)
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	bob.SetFlag(BuilderFlag)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	cmd, _ := parseCommand(client, "@dig/tel east,west=The Den")
+	doDig(world, client, cmd)
+
+	if bob.location == hall || bob.location.name != "The Den" {
+		t.Fatalf("Expected bob to be taken to the den")
+	}
+
+	assertMatch(t, "Dug.\r\nThe Den \\(#3\\)", conn.String())
+}
+
 func TestDoDescriptionUpdatesDescription(t *testing.T) {
 	world := NewWorld()
 	conn := NewMockConn()
@@ -291,7 +371,7 @@ func TestDoDescriptionUpdatesDescription(t *testing.T) {
 	doDesc(world, client, Command{"@desc", "me", "Bob is really tall."})
 
 	if bob.description != "Bob is really tall." {
-		t.Errorf("Bob's description was not updated: " + bob.Description())
+		t.Errorf("Bob's description was not updated: %s", bob.Description())
 	}
 }
 
@@ -378,3 +458,177 @@ func TestDoSetBuilderFlagRequiresWizardPermissions(t *testing.T) {
 	}
 
 }
+
+func TestDoWidthSetsWidth(t *testing.T) {
+	conn := NewMockConn()
+	client := NewClient(conn)
+	world := NewWorld()
+
+	doWidth(world, client, Command{"width", "", "60"})
+
+	if client.width != 60 {
+		t.Errorf("Expected width to be 60, was %d", client.width)
+	}
+
+	assertMatch(t, "Screen width set to 60.\r\n", conn.String())
+
+	doWidth(world, client, Command{"width", "", ""})
+
+	assertMatch(t, "Your screen is 60 characters wide.\r\n", conn.String())
+}
+
+func TestDoWidthRejectsBadWidths(t *testing.T) {
+	conn := NewMockConn()
+	client := NewClient(conn)
+	world := NewWorld()
+
+	doWidth(world, client, Command{"width", "", "5"})
+	doWidth(world, client, Command{"width", "", "wide"})
+
+	if client.width != DEFAULT_WIDTH {
+		t.Errorf("Expected width to be unchanged, was %d", client.width)
+	}
+
+	assertMatch(t, "Try: width <20-250>\r\n", conn.String())
+}
+
+func TestSecureLoginRefusesPlaintextPasswords(t *testing.T) {
+	secureLogin = true
+	defer func() { secureLogin = false }()
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	doNewplayer(world, client, Command{"newplayer", "jim", "bar"})
+
+	assertMatch(t, "Passwords are only accepted over an encrypted connection.\r\n", conn.String())
+
+	if bob.awake || len(world.players) != 1 {
+		t.Fatalf("Passwords should not be accepted over plaintext")
+	}
+
+	client.secure = true
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	if !bob.awake {
+		t.Errorf("Bob should be able to connect over a secure connection")
+	}
+}
+
+func TestDoTellReachesPlayersAnywhere(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	world.NewPlayer("bob", "foo", hall)
+	world.NewPlayer("Jim", "bar", den)
+
+	bobConn, jimConn := NewMockConn(), NewMockConn()
+	bobClient, jimClient := NewClient(bobConn), NewClient(jimConn)
+	doConnect(world, bobClient, Command{"connect", "", "bob foo"})
+	doConnect(world, jimClient, Command{"connect", "", "Jim bar"})
+
+	doTell(world, bobClient, Command{"tell", "JIM", "Where are you?"})
+
+	assertMatch(t, "bob tells you: Where are you\\?\r\n", jimConn.String())
+	assertMatch(t, "You tell Jim: Where are you\\?\r\n", bobConn.String())
+
+	doReply(world, jimClient, Command{"reply", "", "In the den."})
+
+	assertMatch(t, "Jim tells you: In the den.\r\n", bobConn.String())
+	assertMatch(t, "You tell bob: In the den.\r\n", jimConn.String())
+}
+
+func TestDoTellToSleepingPlayer(t *testing.T) {
+	conn := NewMockConn()
+	client := NewClient(conn)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("bob", "foo", hall)
+	world.NewPlayer("jim", "bar", hall)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	doTell(world, client, Command{"tell", "jim", "Wake up!"})
+
+	assertMatch(t, "jim is asleep.\r\n", conn.String())
+
+	doTell(world, client, Command{"tell", "fred", "Hello?"})
+
+	assertMatch(t, "I don't know anyone called fred.\r\n", conn.String())
+}
+
+func TestDoReplyWithNobodyToReplyTo(t *testing.T) {
+	conn := NewMockConn()
+	client := NewClient(conn)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("bob", "foo", hall)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	doReply(world, client, Command{"reply", "", "Hello?"})
+
+	assertMatch(t, "Nobody has told you anything to reply to.\r\n", conn.String())
+}
+
+func TestDoWhoListsConnectedPlayers(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("jim", "bar", hall)
+	world.NewPlayer("bob", "foo", hall)
+	world.NewPlayer("fred", "baz", hall)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "jim bar"})
+	other := NewClient(NewMockConn())
+	doConnect(world, other, Command{"connect", "", "bob foo"})
+
+	other.connectedAt = time.Now().Add(-(2*time.Hour + 3*time.Minute + 4*time.Second))
+	other.lastInput = time.Now().Add(-5 * time.Minute)
+
+	conn.writeBuffer.Reset()
+	doWho(world, client, Command{"who", "", ""})
+
+	assertMatch(t, "Player +On For +Idle\r\n"+
+		"bob +2:03:04 +5m\r\n"+
+		"jim +0:00 +0s\r\n"+
+		"2 players are connected.\r\n", conn.String())
+
+	if strings.Contains(conn.String(), "fred") || strings.Contains(conn.String(), "Address") {
+		t.Errorf("Expected only connected players, without wizard details")
+	}
+}
+
+func TestDoWhoHidesHiddenPlayersFromMortals(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	wizard, _ := world.NewPlayer("Wizard", "xyzzy", hall)
+	world.NewPlayer("bob", "foo", hall)
+	wizard.SetFlag(WizardFlag)
+	wizard.SetFlag(HiddenFlag)
+
+	wizConn := NewMockConn()
+	wizClient := NewClient(wizConn)
+	doConnect(world, wizClient, Command{"connect", "", "Wizard xyzzy"})
+
+	bobConn := NewMockConn()
+	bobClient := NewClient(bobConn)
+	doConnect(world, bobClient, Command{"connect", "", "bob foo"})
+
+	bobConn.writeBuffer.Reset()
+	doWho(world, bobClient, Command{"who", "", ""})
+
+	if strings.Contains(bobConn.String(), "Wizard ") {
+		t.Errorf("Expected the hidden wizard to be left out")
+	}
+
+	assertMatch(t, "One player is connected.\r\n", bobConn.String())
+
+	doWho(world, wizClient, Command{"who", "", ""})
+
+	assertMatch(t, "Wizard \\(hidden\\) .* The Hall \\(#1\\) +192.168.1.1\r\n", wizConn.String())
+	assertMatch(t, "2 players are connected.\r\n", wizConn.String())
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+//
+// Journal operations. Each one corresponds to a mutating method on
+// World.
+//
+const (
+	opNewRoom         = "newroom"
+	opNewExit         = "newexit"
+	opNewPlayer       = "newplayer"
+	opNewThing        = "newthing"
+	opMovePlayer      = "move"
+	opMoveThing       = "movething"
+	opSetDescription  = "desc"
+	opSetFlag         = "setflag"
+	opClearFlag       = "clearflag"
+	opSetOwner        = "owner"
+	opSetPassword     = "password"
+	opSetCapacity     = "capacity"
+	opSetLock         = "lock"
+	opSetFail         = "fail"
+	opSetExitMessage  = "exitmsg"
+	opSetAttr         = "attr"
+	opClearAttr       = "clearattr"
+	opSetAttrFlags    = "attrflags"
+	opDestroy         = "destroy"
+	opAddPublicKey    = "addkey"
+	opRemovePublicKey = "delkey"
+)
+
+//
+// A single change to the world. Not every field is used by every
+// operation; Location is the room a player is placed in, the source
+// room of a new exit, or whatever is holding a thing.
+//
+type JournalEntry struct {
+	Op          string    `json:"op"`
+	Key         int       `json:"key"`
+	Name        string    `json:"name,omitempty"`
+	Password    string    `json:"password,omitempty"`
+	Location    int       `json:"location,omitempty"`
+	Destination int       `json:"destination,omitempty"`
+	Text        string    `json:"text,omitempty"`
+	Flags       Flags     `json:"flags,omitempty"`
+	Owner       int       `json:"owner,omitempty"`
+	Capacity    int       `json:"capacity,omitempty"`
+	AttrFlags   AttrFlags `json:"attrFlags,omitempty"`
+}
+
+//
+// The journal is an append-only log of every change made to the
+// world since the last snapshot was saved. After a crash, replaying
+// it on top of the snapshot brings the world back up to date.
+//
+type Journal struct {
+	sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{file: f, encoder: json.NewEncoder(f)}, nil
+}
+
+func (j *Journal) Record(e JournalEntry) error {
+	j.Lock()
+	defer j.Unlock()
+
+	return j.encoder.Encode(&e)
+}
+
+func (j *Journal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+
+	return j.file.Close()
+}
+
+// Throw away every entry. Only safe once the changes they describe
+// are in a snapshot. The caller must hold the lock.
+func (j *Journal) truncate() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+
+	return j.file.Sync()
+}
+
+func (w *World) record(e JournalEntry) {
+	if w.journal == nil {
+		return
+	}
+
+	if err := w.journal.Record(e); err != nil {
+		errorLog.Println("Could not write to journal:", err)
+	}
+}
+
+//
+// Save a snapshot of the world, and compact the journal down to
+// nothing now that the snapshot holds every change. Must run on the
+// world's goroutine, or while it isn't running, so that no change can
+// land in the snapshot and then be journaled again after truncation.
+//
+func (w *World) Checkpoint(path string) error {
+	if w.journal == nil {
+		return w.Save(path)
+	}
+
+	w.journal.Lock()
+	defer w.journal.Unlock()
+
+	if err := w.Save(path); err != nil {
+		return err
+	}
+
+	return w.journal.truncate()
+}
+
+//
+// Apply every entry in the journal at path to the world, returning
+// the number of entries replayed. A missing journal is not an error.
+//
+func ReplayJournal(w *World, path string) (int, error) {
+	f, err := os.Open(path)
+
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	return w.replay(f)
+}
+
+func (w *World) replay(in io.Reader) (int, error) {
+	decoder := json.NewDecoder(in)
+	count := 0
+
+	for {
+		var e JournalEntry
+
+		err := decoder.Decode(&e)
+
+		// A crash part way through writing an entry leaves a
+		// truncated last line behind. The change it describes never
+		// completed, so it's safe to drop.
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return count, err
+		}
+
+		if err = w.apply(e); err != nil {
+			return count, fmt.Errorf("Journal entry %d: %s", count+1, err)
+		}
+
+		count++
+	}
+
+	w.idGen = KeyGenFrom(w.lastKey())
+
+	return count, nil
+}
+
+func (w *World) apply(e JournalEntry) error {
+	switch e.Op {
+	case opNewRoom:
+		if _, exists := w.object(e.Key); exists {
+			return fmt.Errorf("Key #%d is already in use", e.Key)
+		}
+		w.claimKey(e.Key)
+
+		r := &Room{exits: make(map[int]*Exit), players: make(map[int]*Player)}
+		r.key = e.Key
+		r.SetName(e.Name)
+		w.rooms[r.key] = r
+
+	case opNewExit:
+		if _, exists := w.object(e.Key); exists {
+			return fmt.Errorf("Key #%d is already in use", e.Key)
+		}
+		w.claimKey(e.Key)
+
+		source, exists := w.rooms[e.Location]
+		if !exists {
+			return fmt.Errorf("No such room #%d", e.Location)
+		}
+
+		destination, exists := w.rooms[e.Destination]
+		if !exists {
+			return fmt.Errorf("No such room #%d", e.Destination)
+		}
+
+		x := &Exit{destination: destination}
+		x.key = e.Key
+		x.SetName(e.Name)
+		w.exits[x.key] = x
+		source.exits[x.key] = x
+
+	case opNewPlayer:
+		if _, exists := w.object(e.Key); exists {
+			return fmt.Errorf("Key #%d is already in use", e.Key)
+		}
+		w.claimKey(e.Key)
+
+		location, exists := w.rooms[e.Location]
+		if !exists {
+			return fmt.Errorf("No such room #%d", e.Location)
+		}
+
+		if _, err := parsePasswordHash(e.Password); err != nil {
+			return fmt.Errorf("Bad password hash for player #%d", e.Key)
+		}
+
+		p := &Player{password: e.Password}
+		p.key = e.Key
+		p.SetName(e.Name)
+
+		w.players[p.key] = p
+		w.movePlayer(p, location)
+
+	case opMovePlayer:
+		p, exists := w.players[e.Key]
+		if !exists {
+			return fmt.Errorf("No such player #%d", e.Key)
+		}
+
+		location, exists := w.rooms[e.Location]
+		if !exists {
+			return fmt.Errorf("No such room #%d", e.Location)
+		}
+
+		w.movePlayer(p, location)
+
+	case opNewThing:
+		if _, exists := w.object(e.Key); exists {
+			return fmt.Errorf("Key #%d is already in use", e.Key)
+		}
+		w.claimKey(e.Key)
+
+		location, exists := w.holder(e.Location)
+		if !exists {
+			return fmt.Errorf("No such holder #%d", e.Location)
+		}
+
+		t := &Thing{}
+		t.key = e.Key
+		t.SetName(e.Name)
+		w.things[t.key] = t
+
+		if err := w.moveThing(t, location); err != nil {
+			return err
+		}
+
+	case opMoveThing:
+		t, exists := w.things[e.Key]
+		if !exists {
+			return fmt.Errorf("No such thing #%d", e.Key)
+		}
+
+		location, exists := w.holder(e.Location)
+		if !exists {
+			return fmt.Errorf("No such holder #%d", e.Location)
+		}
+
+		if err := w.moveThing(t, location); err != nil {
+			return err
+		}
+
+	case opSetCapacity:
+		t, exists := w.things[e.Key]
+		if !exists {
+			return fmt.Errorf("No such thing #%d", e.Key)
+		}
+
+		t.capacity = e.Capacity
+
+	case opSetExitMessage:
+		x, exists := w.exits[e.Key]
+		if !exists {
+			return fmt.Errorf("No such exit #%d", e.Key)
+		}
+
+		if !isExitMessage(e.Name) {
+			return fmt.Errorf("Unknown exit message '%s'", e.Name)
+		}
+
+		x.SetMessage(e.Name, e.Text)
+
+	case opDestroy:
+		o, exists := w.object(e.Key)
+		if !exists {
+			return fmt.Errorf("No such object #%d", e.Key)
+		}
+
+		if _, err := w.destroy(o); err != nil {
+			return err
+		}
+
+	case opSetPassword:
+		p, exists := w.players[e.Key]
+		if !exists {
+			return fmt.Errorf("No such player #%d", e.Key)
+		}
+
+		if _, err := parsePasswordHash(e.Password); err != nil {
+			return fmt.Errorf("Bad password hash for player #%d", e.Key)
+		}
+
+		p.password = e.Password
+
+	case opAddPublicKey, opRemovePublicKey:
+		p, exists := w.players[e.Key]
+		if !exists {
+			return fmt.Errorf("No such player #%d", e.Key)
+		}
+
+		if e.Op == opAddPublicKey {
+			p.addPublicKey(e.Text)
+		} else {
+			p.removePublicKey(e.Text)
+		}
+
+	case opSetDescription, opSetFlag, opClearFlag, opSetOwner, opSetLock, opSetFail,
+		opSetAttr, opClearAttr, opSetAttrFlags:
+		o, exists := w.object(e.Key)
+		if !exists {
+			return fmt.Errorf("No such object #%d", e.Key)
+		}
+
+		switch e.Op {
+		case opSetDescription:
+			o.SetDescription(e.Text)
+		case opSetFlag:
+			o.SetFlag(e.Flags)
+		case opClearFlag:
+			o.ClearFlag(e.Flags)
+		case opSetOwner:
+			owner, exists := w.players[e.Owner]
+			if !exists {
+				return fmt.Errorf("No such player #%d", e.Owner)
+			}
+			o.SetOwner(owner)
+		case opSetLock:
+			lock, err := loadLock(e.Text)
+			if err != nil {
+				return err
+			}
+			o.SetLockExpr(lock)
+		case opSetFail:
+			o.SetFailMessage(e.Text)
+		case opSetAttr:
+			if !validAttrName(e.Name) {
+				return fmt.Errorf("Bad attribute name '%s'", e.Name)
+			}
+			o.SetAttribute(e.Name, e.Text)
+		case opClearAttr:
+			o.ClearAttribute(e.Name)
+		case opSetAttrFlags:
+			o.SetAttributeFlags(e.Name, e.AttrFlags)
+		}
+
+	default:
+		return fmt.Errorf("Unknown operation '%s'", e.Op)
+	}
+
+	return nil
+}
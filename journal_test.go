@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestJournal(t *testing.T, world *World) string {
+	path := filepath.Join(t.TempDir(), "world.journal")
+
+	journal, err := OpenJournal(path)
+
+	if err != nil {
+		t.Fatalf("Could not open journal: %s", err)
+	}
+
+	world.journal = journal
+	t.Cleanup(func() { journal.Close() })
+
+	return path
+}
+
+func TestJournalReplaysOnTopOfSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "world.json")
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	world.SetFlag(bob, BuilderFlag)
+
+	if err := world.Save(snapshot); err != nil {
+		t.Fatalf("Could not save world: %s", err)
+	}
+
+	path := openTestJournal(t, world)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	doDig(world, client, Command{"@dig", "east", "The Den"})
+	doDesc(world, client, Command{"@desc", "me", "Bob is really tall."})
+	doMove(world, client, Command{"move", "east", ""})
+	world.NewPlayer("jim", "bar", hall)
+
+	loaded, err := LoadWorld(snapshot)
+
+	if err != nil {
+		t.Fatalf("Could not load world: %s", err)
+	}
+
+	replayed, err := ReplayJournal(loaded, path)
+
+	if err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	if replayed != 7 {
+		t.Errorf("Expected 7 entries to be replayed, got %d", replayed)
+	}
+
+	den, exists := loaded.rooms[3]
+
+	if !exists || den.Name() != "The Den" || den.Owner() != loaded.players[2] {
+		t.Fatalf("Expected the den to be restored and owned by bob")
+	}
+
+	if exit, exists := loaded.rooms[1].exits[4]; !exists || exit.destination != den {
+		t.Errorf("Expected the exit east to be restored")
+	}
+
+	if loaded.players[2].location != den {
+		t.Errorf("Expected bob to be in the den")
+	}
+
+	if loaded.players[2].Description() != "Bob is really tall." {
+		t.Errorf("Expected bob's description to be restored")
+	}
+
+	jim, exists := loaded.players[5]
+
+	if !exists || jim.location != loaded.rooms[1] {
+		t.Fatalf("Expected jim to be restored in the hall")
+	}
+
+	client = NewClient(NewMockConn())
+	doConnect(loaded, client, Command{"connect", "", "jim bar"})
+
+	if client.player != jim {
+		t.Errorf("Expected jim's password to be restored")
+	}
+
+	attic, _ := loaded.NewRoom("The Attic")
+
+	if attic.key != 6 {
+		t.Errorf("Expected the next key to be 6, was %d", attic.key)
+	}
+}
+
+func TestJournalRecordsFlagChanges(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	wizard, _ := world.NewPlayer("wizard", "foo", hall)
+	jim, _ := world.NewPlayer("jim", "foo", hall)
+	wizard.SetFlag(WizardFlag)
+
+	snapshot := reloadWorld(t, world)
+	path := openTestJournal(t, world)
+
+	client := NewClient(NewMockConn())
+	doConnect(world, client, Command{"connect", "", "wizard foo"})
+	doSet(world, client, Command{"@set", "jim", "builder"})
+	doSet(world, client, Command{"@set", "jim", "wizard"})
+	doSet(world, client, Command{"@set", "jim", "!builder"})
+
+	if _, err := ReplayJournal(snapshot, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	restored := snapshot.players[jim.key]
+
+	if !restored.IsSet(WizardFlag) || restored.IsSet(BuilderFlag) {
+		t.Errorf("Expected jim to be a wizard but not a builder")
+	}
+}
+
+func TestJournalIgnoresTruncatedLastEntry(t *testing.T) {
+	world := NewWorld()
+	world.NewRoom("The Hall")
+
+	in := `{"op":"newroom","key":2,"name":"The Den"}
+{"op":"newroom","key":3,"na`
+
+	replayed, err := world.replay(strings.NewReader(in))
+
+	if err != nil {
+		t.Fatalf("Expected a truncated entry to be skipped, got %s", err)
+	}
+
+	if replayed != 1 || len(world.rooms) != 2 {
+		t.Errorf("Expected only the complete entry to be replayed")
+	}
+}
+
+func TestJournalRejectsConflictingKeys(t *testing.T) {
+	world := NewWorld()
+	world.NewRoom("The Hall")
+
+	in := `{"op":"newroom","key":1,"name":"The Den"}`
+
+	if _, err := world.replay(strings.NewReader(in)); err == nil {
+		t.Errorf("Expected a reused key to be rejected")
+	}
+}
+
+func TestReplayMissingJournal(t *testing.T) {
+	world := NewWorld()
+
+	replayed, err := ReplayJournal(world, filepath.Join(t.TempDir(), "nope"))
+
+	if replayed != 0 || err != nil {
+		t.Errorf("Expected a missing journal to replay nothing")
+	}
+}
+
+func TestCheckpointCompactsJournal(t *testing.T) {
+	world := NewWorld()
+	path := openTestJournal(t, world)
+	snapshot := filepath.Join(t.TempDir(), "world.json")
+
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("bob", "foo", hall)
+
+	if info, _ := os.Stat(path); info.Size() == 0 {
+		t.Fatalf("Expected the journal to have entries")
+	}
+
+	if err := world.Checkpoint(snapshot); err != nil {
+		t.Fatalf("Could not checkpoint: %s", err)
+	}
+
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("Expected the journal to be empty after a checkpoint")
+	}
+
+	world.NewRoom("The Den")
+
+	loaded, _ := LoadWorld(snapshot)
+
+	if _, err := ReplayJournal(loaded, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	if len(loaded.rooms) != 2 || len(loaded.players) != 1 {
+		t.Errorf("Expected snapshot and journal to hold the whole world")
+	}
+}
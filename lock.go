@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//
+// A lock decides who may use an object: take an exit, enter a room
+// or pick up a thing. Locks are written as boolean expressions, e.g.
+//
+//	wizard|#12&!#34
+//
+// where "#12" passes for player #12 or anyone carrying thing #12, a
+// flag name passes for anyone with that flag, "!" is not, "&" is and,
+// "|" is or, and parentheses group. "&" binds tighter than "|".
+//
+type LockExpr interface {
+	Passes(p *Player) bool
+	String() string
+}
+
+type lockOr struct {
+	left, right LockExpr
+}
+
+type lockAnd struct {
+	left, right LockExpr
+}
+
+type lockNot struct {
+	expr LockExpr
+}
+
+// A player, or a thing that must be carried
+type lockKey struct {
+	key int
+}
+
+type lockFlag struct {
+	name string
+	flag Flags
+}
+
+// The flags a lock may test, by name.
+var lockFlags = map[string]Flags{
+	"wizard":     WizardFlag,
+	"builder":    BuilderFlag,
+	"programmer": ProgrammerFlag,
+}
+
+func (l *lockOr) Passes(p *Player) bool {
+	return l.left.Passes(p) || l.right.Passes(p)
+}
+
+func (l *lockAnd) Passes(p *Player) bool {
+	return l.left.Passes(p) && l.right.Passes(p)
+}
+
+func (l *lockNot) Passes(p *Player) bool {
+	return !l.expr.Passes(p)
+}
+
+func (l *lockKey) Passes(p *Player) bool {
+	_, carrying := p.things[l.key]
+	return p.key == l.key || carrying
+}
+
+func (l *lockFlag) Passes(p *Player) bool {
+	return p.IsSet(l.flag)
+}
+
+//
+// Locks print back in a form that parses to the same tree, with only
+// the parentheses needed to keep it that way.
+//
+func (l *lockOr) String() string {
+	return l.left.String() + "|" + l.right.String()
+}
+
+func (l *lockAnd) String() string {
+	return groupOr(l.left) + "&" + groupOr(l.right)
+}
+
+func (l *lockNot) String() string {
+	switch l.expr.(type) {
+	case *lockOr, *lockAnd:
+		return "!(" + l.expr.String() + ")"
+	}
+
+	return "!" + l.expr.String()
+}
+
+func (l *lockKey) String() string {
+	return "#" + strconv.Itoa(l.key)
+}
+
+func (l *lockFlag) String() string {
+	return l.name
+}
+
+func groupOr(l LockExpr) string {
+	if _, isOr := l.(*lockOr); isOr {
+		return "(" + l.String() + ")"
+	}
+
+	return l.String()
+}
+
+//
+// Parse a lock expression. An empty expression is an error; an
+// object with no lock is unlocked, and has a nil LockExpr.
+//
+func ParseLock(s string) (LockExpr, error) {
+	p := &lockParser{input: s}
+
+	expr, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.next(); tok != "" {
+		return nil, fmt.Errorf("Unexpected '%s' in lock.", tok)
+	}
+
+	return expr, nil
+}
+
+type lockParser struct {
+	input string
+	pos   int
+}
+
+// Return the next token without consuming it. Tokens are the
+// operators, parentheses, and runs of anything else.
+func (p *lockParser) peek() string {
+	rest := strings.TrimLeft(p.input[p.pos:], " ")
+
+	if rest == "" {
+		return ""
+	}
+
+	if strings.ContainsRune("|&!()", rune(rest[0])) {
+		return rest[:1]
+	}
+
+	end := strings.IndexAny(rest, "|&!() ")
+
+	if end < 0 {
+		return rest
+	}
+
+	return rest[:end]
+}
+
+func (p *lockParser) next() string {
+	tok := p.peek()
+
+	p.pos = len(p.input) - len(strings.TrimLeft(p.input[p.pos:], " ")) + len(tok)
+
+	return tok
+}
+
+func (p *lockParser) parseOr() (LockExpr, error) {
+	left, err := p.parseAnd()
+
+	for err == nil && p.peek() == "|" {
+		p.next()
+
+		var right LockExpr
+		if right, err = p.parseAnd(); err == nil {
+			left = &lockOr{left, right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *lockParser) parseAnd() (LockExpr, error) {
+	left, err := p.parseNot()
+
+	for err == nil && p.peek() == "&" {
+		p.next()
+
+		var right LockExpr
+		if right, err = p.parseNot(); err == nil {
+			left = &lockAnd{left, right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *lockParser) parseNot() (LockExpr, error) {
+	tok := p.next()
+
+	switch tok {
+	case "":
+		return nil, errors.New("Lock ends too soon.")
+
+	case "!":
+		expr, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &lockNot{expr}, nil
+
+	case "(":
+		expr, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next() != ")" {
+			return nil, errors.New("Missing ')' in lock.")
+		}
+
+		return expr, nil
+
+	case "|", "&", ")":
+		return nil, fmt.Errorf("Unexpected '%s' in lock.", tok)
+	}
+
+	if strings.HasPrefix(tok, "#") {
+		key, err := strconv.Atoi(tok[1:])
+
+		if err != nil || key <= 0 {
+			return nil, fmt.Errorf("Bad object number '%s' in lock.", tok)
+		}
+
+		return &lockKey{key}, nil
+	}
+
+	name := strings.ToLower(tok)
+
+	if flag, exists := lockFlags[name]; exists {
+		return &lockFlag{name, flag}, nil
+	}
+
+	return nil, fmt.Errorf("I don't know what '%s' means in a lock.", tok)
+}
+
+//
+// The error returned when a player is stopped by a lock. The message
+// is the object's failure message if it has one, or a default to
+// suit what the player was trying to do.
+//
+type LockedError struct {
+	Object  Objecter
+	Message string
+}
+
+func (e *LockedError) Error() string {
+	return e.Message
+}
+
+//
+// Check a player against an object's lock, returning a LockedError
+// with the given default message if they're stopped.
+//
+func checkLock(p *Player, o Objecter, message string) error {
+	if o.Passes(p) {
+		return nil
+	}
+
+	if fail := o.FailMessage(); fail != "" {
+		message = substitute(fail, p)
+	}
+
+	return &LockedError{Object: o, Message: message}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLock(t *testing.T) {
+	cases := map[string]string{
+		"wizard":              "wizard",
+		" Wizard | #12 ":      "wizard|#12",
+		"wizard|#12&!#34":     "wizard|#12&!#34",
+		"(wizard|#12)&!#34":   "(wizard|#12)&!#34",
+		"!(builder&#3)":       "!(builder&#3)",
+		"!!programmer":        "!!programmer",
+		"((#1))|(#2|(#3&#4))": "#1|#2|#3&#4",
+	}
+
+	for in, want := range cases {
+		lock, err := ParseLock(in)
+
+		if err != nil {
+			t.Errorf("Could not parse %q: %s", in, err)
+			continue
+		}
+
+		if lock.String() != want {
+			t.Errorf("Expected %q to parse as %q, got %q", in, want, lock.String())
+		}
+	}
+}
+
+func TestParseLockRejectsGarbage(t *testing.T) {
+	bad := []string{"", "  ", "wizard|", "&#1", "(#1", "#1)", "#x", "#0", "wizard #1", "frobozz"}
+
+	for _, s := range bad {
+		if _, err := ParseLock(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestLockPasses(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	jim, _ := world.NewPlayer("jim", "bar", hall)
+	key, _ := world.NewThing("Key", jim)
+
+	lock, _ := ParseLock("wizard|#2")
+
+	if !lock.Passes(bob) || lock.Passes(jim) {
+		t.Errorf("Expected only bob to pass")
+	}
+
+	lock, _ = ParseLock("#4&!wizard")
+
+	if !lock.Passes(jim) || lock.Passes(bob) {
+		t.Errorf("Expected only jim, carrying the key, to pass")
+	}
+
+	jim.SetFlag(WizardFlag)
+
+	if lock.Passes(jim) {
+		t.Errorf("Expected jim not to pass once he's a wizard")
+	}
+
+	world.MoveThing(key, bob)
+
+	if !lock.Passes(bob) {
+		t.Errorf("Expected bob to pass once he has the key")
+	}
+}
+
+func TestUseExitChecksLocks(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	door, _ := world.NewExit(hall, "door", den)
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+
+	lock, _ := ParseLock("wizard")
+	world.SetLock(door, lock)
+
+	r, err := world.UseExit(bob, door)
+
+	var locked *LockedError
+
+	if !errors.As(err, &locked) || locked.Object != door || r != hall || bob.location != hall {
+		t.Fatalf("Expected the locked door to stop bob, got %v", err)
+	}
+
+	if err.Error() != "You can't go that way." {
+		t.Errorf("Unexpected default message %q", err)
+	}
+
+	world.SetFailMessage(door, "The door is locked.")
+
+	if _, err = world.UseExit(bob, door); err == nil || err.Error() != "The door is locked." {
+		t.Errorf("Expected the door's failure message, got %v", err)
+	}
+
+	world.SetLock(door, nil)
+	world.SetLock(den, lock)
+
+	if _, err = world.MovePlayer(bob, den); !errors.As(err, &locked) || locked.Object != den {
+		t.Errorf("Expected the locked den to keep bob out, got %v", err)
+	}
+
+	bob.SetFlag(WizardFlag)
+
+	if r, err = world.UseExit(bob, door); err != nil || r != den || bob.location != den {
+		t.Errorf("Expected a wizard to get into the den, got %v", err)
+	}
+}
+
+func TestDoMoveAndGetReportLocks(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	door, _ := world.NewExit(hall, "door", den)
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	statue, _ := world.NewThing("Statue", hall)
+
+	lock, _ := ParseLock("#1")
+	world.SetLock(door, lock)
+	world.SetLock(statue, lock)
+	world.SetFailMessage(statue, "It's far too heavy.")
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	doMove(world, client, Command{"move", "door", ""})
+
+	if bob.location != hall {
+		t.Errorf("Expected bob to stay in the hall")
+	}
+
+	assertMatch(t, "You can't go that way.\r\n", conn.String())
+
+	doGet(world, client, Command{"get", "statue", ""})
+
+	if statue.Location() != hall {
+		t.Errorf("Expected the statue to stay in the hall")
+	}
+
+	assertMatch(t, "It's far too heavy.\r\n", conn.String())
+}
+
+func TestDoLockNeedsOwner(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	door, _ := world.NewExit(hall, "door", den)
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	doLock(world, client, Command{"@lock", "door", "wizard"})
+
+	if door.LockExpr() != nil {
+		t.Fatalf("Expected bob not to be able to lock the door")
+	}
+
+	world.SetOwner(door, bob)
+	doLock(world, client, Command{"@lock", "door", "wizard|"})
+
+	assertMatch(t, "Lock ends too soon.\r\n", conn.String())
+
+	doLock(world, client, Command{"@lock", "door", "wizard|#2"})
+
+	if door.LockExpr() == nil || door.LockExpr().String() != "wizard|#2" {
+		t.Fatalf("Expected bob to lock his door")
+	}
+
+	doFail(world, client, Command{"@fail", "door", "Bolted."})
+	doExamine(world, client, Command{"examine", "door", ""})
+
+	assertMatch(t, "Lock: wizard\\|#2\r\nFail: Bolted.\r\n", conn.String())
+
+	doUnlock(world, client, Command{"@unlock", "door", ""})
+
+	if door.LockExpr() != nil {
+		t.Errorf("Expected bob to unlock his door")
+	}
+}
+
+func TestLocksArePersistedAndJournaled(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "world.json")
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	door, _ := world.NewExit(hall, "door", den)
+	lock, _ := ParseLock("builder&!#3")
+	world.SetLock(door, lock)
+	world.SetFailMessage(door, "Stuck.")
+	world.Save(snapshot)
+
+	loaded := reloadWorld(t, world)
+	restored := loaded.exits[door.key]
+
+	if restored.LockExpr() == nil || restored.LockExpr().String() != "builder&!#3" || restored.FailMessage() != "Stuck." {
+		t.Fatalf("Expected the door's lock to be restored")
+	}
+
+	path := openTestJournal(t, world)
+	world.SetLock(door, nil)
+	world.SetLock(den, lock)
+	world.SetFailMessage(door, "")
+
+	replayed, _ := LoadWorld(snapshot)
+
+	if _, err := ReplayJournal(replayed, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	if replayed.exits[door.key].LockExpr() != nil || replayed.exits[door.key].FailMessage() != "" {
+		t.Errorf("Expected the door to be unlocked after replay")
+	}
+
+	if replayed.rooms[den.key].LockExpr() == nil {
+		t.Errorf("Expected the den to be locked after replay")
+	}
+}
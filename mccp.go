@@ -0,0 +1,58 @@
+package main
+
+import (
+	"compress/zlib"
+)
+
+//
+// MCCP2 (option 86) compresses everything we send to a client with
+// zlib, which makes a big difference to players on slow links.
+//
+
+//
+// Start compressing output. Once the client has seen IAC SB
+// COMPRESS2 IAC SE, everything after it is one zlib stream until we
+// end it.
+//
+func (t *Telnet) StartCompression() error {
+	if t.compressor != nil {
+		return nil
+	}
+
+	if _, err := t.out.Write([]byte{IAC, SB, MCCP2, IAC, SE}); err != nil {
+		return err
+	}
+
+	t.compressor = zlib.NewWriter(t.out)
+
+	return nil
+}
+
+//
+// Finish the compressed stream cleanly, and go back to sending plain
+// output.
+//
+func (t *Telnet) StopCompression() error {
+	if t.compressor == nil {
+		return nil
+	}
+
+	err := t.compressor.Close()
+	t.compressor = nil
+
+	return err
+}
+
+func (c *Client) compressionChanged(enabled bool) {
+	var err error
+
+	if enabled {
+		err = c.telnet.StartCompression()
+	} else {
+		err = c.telnet.StopCompression()
+	}
+
+	if err != nil {
+		errorLog.Println("Could not change compression for", c.conn.RemoteAddr(), err)
+	}
+}
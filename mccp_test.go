@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+	"time"
+)
+
+var compressStart = []byte{IAC, SB, MCCP2, IAC, SE}
+
+// Decompress everything a MockConn was sent after compression started.
+func decompressed(t *testing.T, conn *MockConn) (string, error) {
+	output := conn.writeBuffer.Bytes()
+	start := bytes.Index(output, compressStart)
+
+	if start < 0 {
+		t.Fatalf("Expected compression to have started, got %q", output)
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(output[start+len(compressStart):]))
+
+	if err != nil {
+		t.Fatalf("Could not start decompressing: %s", err)
+	}
+
+	var plain bytes.Buffer
+	_, err = io.Copy(&plain, reader)
+
+	return plain.String(), err
+}
+
+func newCompressedClient() (*Client, *MockConn) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+	conn.readBytes = append(conn.readBytes, []byte{IAC, DO, MCCP2, '\r', '\n'})
+
+	client := NewClient(conn)
+	client.negotiate()
+	readAllLines(client.telnet)
+
+	return client, conn
+}
+
+func TestClientOffersCompression(t *testing.T) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+	client := NewClient(conn)
+
+	client.negotiate()
+
+	if !bytes.Contains(conn.writeBuffer.Bytes(), []byte{IAC, WILL, MCCP2}) {
+		t.Errorf("Expected the server to offer MCCP2")
+	}
+
+	if bytes.Contains(conn.writeBuffer.Bytes(), compressStart) {
+		t.Errorf("Compression should not start until the client agrees")
+	}
+}
+
+func TestCompressedOutput(t *testing.T) {
+	client, conn := newCompressedClient()
+
+	client.Tell("Hello, world!")
+	client.Tell("Goodbye, world!")
+	client.Close()
+
+	plain, err := decompressed(t, conn)
+
+	if err != nil {
+		t.Errorf("Expected a cleanly finished stream, got %s", err)
+	}
+
+	if plain != "Hello, world!\r\nGoodbye, world!\r\n" {
+		t.Errorf("Unexpected decompressed output %q", plain)
+	}
+}
+
+func TestCompressedOutputIsFlushedPerWrite(t *testing.T) {
+	client, conn := newCompressedClient()
+
+	client.Tell("Hello, world!")
+
+	// The stream hasn't been finished, but everything written so far
+	// should already be readable.
+	plain, err := decompressed(t, conn)
+
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected an unfinished stream, got %v", err)
+	}
+
+	if plain != "Hello, world!\r\n" {
+		t.Errorf("Unexpected decompressed output %q", plain)
+	}
+}
+
+func TestCompressionStopsWhenRefused(t *testing.T) {
+	client, conn := newCompressedClient()
+
+	client.Tell("Squeezed")
+	conn.readBytes = append(conn.readBytes, []byte{IAC, DONT, MCCP2, '\r', '\n'})
+	readAllLines(client.telnet)
+
+	if client.telnet.compressor != nil {
+		t.Fatalf("Expected compression to have stopped")
+	}
+
+	conn.writeBuffer.Reset()
+	client.Tell("Plain")
+
+	if conn.String() != "Plain\r\n" {
+		t.Errorf("Expected plain output after compression stopped, got %q", conn.String())
+	}
+}
+
+type failingWriter struct {
+	bytes.Buffer
+	fail   bool
+	closed chan struct{}
+}
+
+func (w *failingWriter) Read(b []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.fail {
+		return 0, io.ErrClosedPipe
+	}
+	return w.Buffer.Write(b)
+}
+
+func (w *failingWriter) Close() error {
+	close(w.closed)
+	return nil
+}
+
+func TestCompressionErrorClosesConnection(t *testing.T) {
+	w := &failingWriter{closed: make(chan struct{})}
+	telnet := NewTelnet(w)
+
+	telnet.StartCompression()
+	w.fail = true
+
+	if _, err := telnet.Write([]byte("lost")); err == nil {
+		t.Errorf("Expected the write to fail")
+	}
+
+	select {
+	case <-w.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the connection to be closed")
+	}
+
+	// Nothing may follow the broken stream, compressed or not.
+	w.fail = false
+	w.Reset()
+
+	if _, err := telnet.Write([]byte("plain")); err == nil || w.Len() != 0 {
+		t.Errorf("Expected no more output, got %q", w.String())
+	}
+}
@@ -2,22 +2,54 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
-	"sync"
 	"syscall"
+	"time"
 )
 
 const PORT = 8888
+const TLSPORT = 8889
+const WEBPORT = 8080
+const SSHPORT = 2222
+const WORLDFILE = "world.json"
+const JOURNALFILE = "world.journal"
+const CHECKPOINT_INTERVAL = 15 * time.Minute
+
+// How often the world's heartbeat runs timers that are due
+const TICK = time.Second
+
+// Where new players start, and where players go if their room is
+// destroyed
+const START_ROOM = 1
+
+// Screen size to assume until the client tells us otherwise
+const DEFAULT_WIDTH = 80
+const DEFAULT_HEIGHT = 24
+
+// Limits on the width a player can set by hand
+const MIN_WIDTH = 20
+const MAX_WIDTH = 250
+
+// How many bytes of output may wait for a client that isn't keeping up
+const OUTPUT_LIMIT = 64 * 1024
 
 var world *World = NewWorld()
 var debugLog, infoLog, errorLog *log.Logger
 
+// Refuse to take passwords over connections that aren't encrypted
+var secureLogin bool
+
+// What to do with clients whose output backs up
+var outputOverflow OverflowPolicy
+
 type CommandHandler func(*World, *Client, Command)
 
 type CmdType uint8
@@ -38,25 +70,56 @@ type CommandDesc struct {
 type HandlerMap map[string]CommandDesc
 
 var commandHandlers = HandlerMap{
-	"@desc":     {TargetedCmd, false, true, doDesc},
-	"@dig":      {TargetedCmd, false, true, doDig},
-	"@help":     {UnaryCmd, false, true, doHelp},
-	"@link":     {TargetedCmd, false, true, doLink},
-	"connect":   {ArgsCmd, true, false, doConnect},
-	"examine":   {TargetedCmd, false, true, doExamine},
-	"ex":        {TargetedCmd, false, true, doExamine},
-	"newplayer": {TargetedCmd, true, false, doNewplayer},
-	"emote":     {ArgsCmd, false, true, doEmote},
-	"go":        {TargetedCmd, false, true, doMove},
-	"help":      {UnaryCmd, false, true, doHelp},
-	"look":      {TargetedCmd, false, true, doLook},
-	"l":         {TargetedCmd, false, true, doLook},
-	"move":      {TargetedCmd, false, true, doMove},
-	"quit":      {UnaryCmd, true, true, doQuit},
-	"say":       {ArgsCmd, false, true, doSay},
-	"@set":      {TargetedCmd, false, true, doSet},
-	"tell":      {TargetedCmd, false, true, doTell},
-	"walk":      {TargetedCmd, false, true, doMove},
+	"@aflag":     {TargetedCmd, false, true, doAttrFlag},
+	"@addkey":    {ArgsCmd, false, true, doAddKey},
+	"@arrive":    {TargetedCmd, false, true, doArrive},
+	"@attr":      {TargetedCmd, false, true, doAttr},
+	"@clear":     {TargetedCmd, false, true, doClear},
+	"@container": {TargetedCmd, false, true, doContainer},
+	"@create":    {ArgsCmd, false, true, doCreate},
+	"@delkey":    {ArgsCmd, false, true, doDelKey},
+	"@keys":      {UnaryCmd, false, true, doKeys},
+	"@destroy":   {TargetedCmd, false, true, doDestroy},
+	"@desc":      {TargetedCmd, false, true, doDesc},
+	"@dig":       {TargetedCmd, false, true, doDig},
+	"@dig/tel":   {TargetedCmd, false, true, doDig},
+	"@fail":      {TargetedCmd, false, true, doFail},
+	"@get":       {TargetedCmd, false, true, doGetAttr},
+	"@help":      {UnaryCmd, false, true, doHelp},
+	"@leave":     {TargetedCmd, false, true, doLeave},
+	"@link":      {TargetedCmd, false, true, doLink},
+	"@lock":      {TargetedCmd, false, true, doLock},
+	"close":      {TargetedCmd, false, true, doClose},
+	"connect":    {ArgsCmd, true, false, doConnect},
+	"examine":    {TargetedCmd, false, true, doExamine},
+	"ex":         {TargetedCmd, false, true, doExamine},
+	"newplayer":  {TargetedCmd, true, false, doNewplayer},
+	"open":       {TargetedCmd, false, true, doOpen},
+	"emote":      {ArgsCmd, false, true, doEmote},
+	"drop":       {TargetedCmd, false, true, doDrop},
+	"get":        {TargetedCmd, false, true, doGet},
+	"give":       {TargetedCmd, false, true, doGive},
+	"go":         {TargetedCmd, false, true, doMove},
+	"i":          {UnaryCmd, false, true, doInventory},
+	"inventory":  {UnaryCmd, false, true, doInventory},
+	"help":       {UnaryCmd, false, true, doHelp},
+	"look":       {TargetedCmd, false, true, doLook},
+	"l":          {TargetedCmd, false, true, doLook},
+	"move":       {TargetedCmd, false, true, doMove},
+	"page":       {TargetedCmd, false, true, doTell},
+	"put":        {ArgsCmd, false, true, doPut},
+	"quit":       {UnaryCmd, true, true, doQuit},
+	"reply":      {ArgsCmd, false, true, doReply},
+	"say":        {ArgsCmd, false, true, doSay},
+	"take":       {TargetedCmd, false, true, doGet},
+	"@recycle":   {TargetedCmd, false, true, doDestroy},
+	"@set":       {TargetedCmd, false, true, doSet},
+	"@succ":      {TargetedCmd, false, true, doSucc},
+	"@unlock":    {TargetedCmd, false, true, doUnlock},
+	"tell":       {TargetedCmd, false, true, doTell},
+	"walk":       {TargetedCmd, false, true, doMove},
+	"who":        {UnaryCmd, false, true, doWho},
+	"width":      {ArgsCmd, true, true, doWidth},
 }
 
 // A command entered at the MUD's prompt
@@ -71,19 +134,153 @@ type Command struct {
 // and a connection together.
 //
 type Client struct {
-	sync.RWMutex
 	conn          net.Conn
+	telnet        *Telnet
+	secure        bool
 	player        *Player
 	quitRequested bool
+	// If set, the next line of input is handed to this function
+	// instead of being parsed as a command.
+	prompt func(line string)
+	// The last player to send us a private message
+	replyTo *Player
+	// When the player logged in, and when we last heard from them
+	connectedAt time.Time
+	lastInput   time.Time
+	// The size of the client's screen, in characters. Output is
+	// wrapped to the width.
+	width  int
+	height int
+	// What the client has told us about itself over GMCP
+	gmcpClient   string
+	gmcpVersion  string
+	gmcpSupports map[string]int
+	// Output waiting for the writer goroutine, if the client has
+	// one, and whether some has been dropped because it was full
+	output        *outputQueue
+	droppedOutput bool
+	// Set while the world works on something for the client away from
+	// its goroutine, such as checking a password. Input that arrives
+	// meanwhile is held, then handed to resume when it's done.
+	waiting bool
+	held    []string
+	resume  func(client *Client, lines []string)
 }
 
 func NewClient(conn net.Conn) *Client {
-	return &Client{conn: conn, quitRequested: false}
+	c := &Client{conn: conn, telnet: NewTelnet(conn), quitRequested: false,
+		width: DEFAULT_WIDTH, height: DEFAULT_HEIGHT}
+	c.telnet.OnSubnegotiation(NAWS, c.receiveWindowSize)
+	c.telnet.OnSubnegotiation(GMCP, c.receiveGMCP)
+	c.telnet.OnOptionChange(MCCP2, c.compressionChanged)
+	return c
+}
+
+//
+// Create a client for a connection that carries plain lines of text
+// rather than the telnet protocol.
+//
+func NewPlainClient(conn net.Conn) *Client {
+	c := NewClient(conn)
+	c.telnet.plain = true
+	return c
+}
+
+//
+// Ask the client to tell us about the things we support.
+//
+func (c *Client) negotiate() {
+	c.telnet.Do(NAWS)
+	c.telnet.Will(GMCP)
+	c.telnet.Will(MCCP2)
+}
+
+//
+// Send output through a queue, drained by a goroutine of its own,
+// rather than writing it as it's produced.
+//
+func (c *Client) startOutput() {
+	c.output = newOutputQueue(c.conn, OUTPUT_LIMIT, outputOverflow)
+	c.telnet.out = c.output
+
+	go c.output.drain()
+}
+
+//
+// Close the connection, first ending any compressed stream so the
+// client sees a clean finish, and sending anything still queued.
+//
+func (c *Client) Close() error {
+	c.telnet.StopCompression()
+
+	if c.output != nil {
+		return c.output.Close()
+	}
+
+	return c.conn.Close()
+}
+
+// NAWS (RFC 1073) sends the width and height as two 16-bit values.
+func (c *Client) receiveWindowSize(data []byte) {
+	if len(data) != 4 {
+		return
+	}
+
+	width := int(data[0])<<8 | int(data[1])
+	height := int(data[2])<<8 | int(data[3])
+
+	// Zero means the client doesn't know, so keep what we have.
+	if width > 0 {
+		c.width = width
+	}
+
+	if height > 0 {
+		c.height = height
+	}
 }
 
 func (c *Client) Tell(msg string, args ...interface{}) {
-	s := fmt.Sprintf(msg+"\r\n", args...)
-	c.conn.Write([]byte(s))
+	if !c.roomForOutput() {
+		return
+	}
+
+	s := wordWrap(fmt.Sprintf(msg, args...), c.width) + "\r\n"
+	c.telnet.Write([]byte(s))
+}
+
+// Ask for the next line of input, and hand it to f.
+func (c *Client) Prompt(msg string, f func(line string)) {
+	c.Tell("%s", msg)
+	c.prompt = f
+}
+
+//
+// Turn off the client's local echo, e.g. while a password is typed.
+// By telnet convention we do this by offering to echo ourselves, and
+// then not doing so.
+//
+func (c *Client) EchoOff() {
+	c.telnet.Will(ECHO)
+
+	if e, ok := c.conn.(echoer); ok {
+		e.SetEcho(false)
+	}
+}
+
+func (c *Client) EchoOn() {
+	c.telnet.Wont(ECHO)
+
+	if e, ok := c.conn.(echoer); ok {
+		e.SetEcho(true)
+	}
+}
+
+//
+// A connection that echoes input back to the player itself, rather
+// than leaving it to the client.
+//
+type echoer interface {
+	SetEcho(on bool)
 }
 
 func (client *Client) examine(o Objecter) {
@@ -92,13 +289,47 @@ func (client *Client) examine(o Objecter) {
 	if o.Owner() != nil {
 		client.Tell("Owner: %s (#%d)", o.Owner().Name(), o.Owner().Key())
 	}
+
+	if o.LockExpr() != nil {
+		client.Tell("Lock: %s", o.LockExpr())
+	}
+
+	if o.FailMessage() != "" {
+		client.Tell("Fail: %s", o.FailMessage())
+	}
+
+	for _, a := range o.Attributes() {
+		if !canSeeAttr(client.player, o, a) {
+			continue
+		}
+
+		if a.Flags != 0 {
+			client.Tell("%s [%s]: %s", a.Name, a.Flags, a.Value)
+		} else {
+			client.Tell("%s: %s", a.Name, a.Value)
+		}
+	}
+
+	if e, isExit := o.(*Exit); isExit {
+		if msg := e.Message(SuccessMessage); msg != "" {
+			client.Tell("Succ: %s", msg)
+		}
+
+		if msg := e.Message(LeaveMessage); msg != "" {
+			client.Tell("Leave: %s", msg)
+		}
+
+		if msg := e.Message(ArriveMessage); msg != "" {
+			client.Tell("Arrive: %s", msg)
+		}
+	}
 }
 
 func (client *Client) lookAt(o Objecter) {
 	player := client.player
 
 	client.Tell("%s (#%d)", o.Name(), o.Key())
-	client.Tell(o.Description())
+	client.Tell("%s", o.Description())
 
 	// If the Object is a room, we want more info.
 	switch o.(type) {
@@ -108,7 +339,7 @@ func (client *Client) lookAt(o Objecter) {
 		if len(r.exits) > 0 {
 			client.Tell("You can see the following exits:")
 			for _, exit := range r.exits {
-				client.Tell("  %s", exit.name)
+				client.Tell("  %s", exit.DisplayName())
 			}
 		}
 
@@ -124,6 +355,39 @@ func (client *Client) lookAt(o Objecter) {
 				}
 			}
 		}
+
+		if things := r.Things(); len(things) > 0 {
+			client.Tell("You see:")
+			for _, t := range things {
+				client.Tell("  %s", t.name)
+			}
+		}
+
+	case *Player:
+		if things := o.(*Player).Things(); len(things) > 0 {
+			client.Tell("Carrying:")
+			for _, t := range things {
+				client.Tell("  %s", t.name)
+			}
+		}
+
+	case *Thing:
+		t := o.(*Thing)
+
+		if !t.IsContainer() {
+			break
+		}
+
+		if !t.IsOpen() {
+			client.Tell("It is closed.")
+		} else if things := t.Things(); len(things) > 0 {
+			client.Tell("Contains:")
+			for _, inner := range things {
+				client.Tell("  %s", inner.name)
+			}
+		} else {
+			client.Tell("It is empty.")
+		}
 	}
 }
 
@@ -138,6 +402,18 @@ func parseCommand(client *Client, line string) (Command, error) {
 		line = "say " + line[1:len(line)]
 	} else if strings.HasPrefix(line, ":") {
 		line = "emote " + line[1:len(line)]
+	} else if strings.HasPrefix(line, "&") {
+		// '&attr obj=value' is 'set attribute attr on obj'
+		attr := strings.SplitN(line[1:], " ", 2)
+		object := ""
+		if len(attr) > 1 {
+			object = attr[1]
+		}
+		object, value, hasValue := strings.Cut(object, "=")
+		line = "@attr " + strings.TrimSpace(object) + "/" + attr[0]
+		if hasValue {
+			line += "=" + value
+		}
 	}
 
 	// Now we further tokenize the line into VERB and ARGS
@@ -154,13 +430,21 @@ func parseCommand(client *Client, line string) (Command, error) {
 	// there. If the verb is the name of a direction, we short-circuit
 	// and return a Command of the right form. We only do this,
 	// though, if the command is not a keyword.
+	//
+	// Failing that, it may be a verb programmed on something nearby.
 
 	if !isKeyword && client.player != nil {
-		location := client.player.location
-		for _, exit := range location.exits {
-			if tokenized[0] == exit.name {
-				return Command{verb: "move", target: tokenized[0]}, nil
-			}
+		if client.player.location.FindExit(tokenized[0]) != nil {
+			return Command{verb: "move", target: tokenized[0]}, nil
+		}
+
+		rest := ""
+		if len(tokenized) > 1 {
+			rest = tokenized[1]
+		}
+
+		if findVerb(client.player, verb, rest) != nil {
+			return Command{verb: verb, args: rest}, nil
 		}
 	}
 
@@ -206,30 +490,85 @@ func welcome(client *Client) {
 }
 
 //
-// Handle a single client connection loop
+// Handle a single client connection loop. This goroutine only reads
+// from the connection; the world's goroutine does everything else.
 //
-func connectionLoop(conn net.Conn) {
-	linebuf := make([]byte, 1024, 1024)
-	client := NewClient(conn)
+func connectionLoop(client *Client) {
+	conn := client.conn
 
-	welcome(client)
+	if client.output == nil {
+		client.startOutput()
+	}
 
-	// Loop on input and handle it.
-	for {
-		// // Uncomment if we want a prompt...
-		// client.Tell("mud> ")
-		n, err := conn.Read(linebuf)
+	world.Do(func(w *World) {
+		client.negotiate()
+
+		// Connections that log the player in up front (e.g. SSH
+		// with a key) don't need telling how to connect.
+		if client.player == nil {
+			welcome(client)
+		}
+	})
+
+	buf := make([]byte, 1024)
+
+	for !client.quitRequested {
+		n, err := conn.Read(buf)
+
+		if n > 0 {
+			world.Do(func(w *World) { w.handleInput(client, buf[:n]) })
+		}
 
 		if err != nil {
-			if err != io.EOF {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
 				errorLog.Println("Error:", err)
 			}
 			break
 		}
+	}
+
+	infoLog.Println("Disconnection from", conn.RemoteAddr())
+
+	world.Do(func(w *World) {
+		if client.player != nil {
+			w.disconnectPlayer(client)
+		}
+
+		// Don't log the client in if its password is still being
+		// checked.
+		client.quitRequested = true
+		client.Close()
+	})
+}
 
-		line := strings.TrimSpace(string(linebuf[:n]))
+//
+// Handle input from a client, one line at a time.
+//
+func (w *World) handleInput(client *Client, data []byte) {
+	w.handleLines(client, client.telnet.Receive(data))
+}
+
+func (w *World) handleLines(client *Client, lines []string) {
+	for i, line := range lines {
+		if client.quitRequested {
+			return
+		}
 
-		if len(line) > 0 {
+		if client.waiting {
+			client.held = append(client.held, lines[i:]...)
+			client.resume = w.handleLines
+			return
+		}
+
+		client.lastInput = time.Now()
+
+		line = strings.TrimSpace(line)
+
+		if client.prompt != nil {
+			prompt := client.prompt
+			client.prompt = nil
+			prompt(line)
+		} else if len(line) > 0 {
 			command, error := parseCommand(client, line)
 
 			if error != nil {
@@ -237,24 +576,35 @@ func connectionLoop(conn net.Conn) {
 				continue
 			}
 
-			world.handleCommand(&commandHandlers, client, command)
+			w.handleCommand(&commandHandlers, client, command)
 		}
+	}
+}
 
-		if client.quitRequested {
-			break
+//
+// Accept connections until the listener is closed. Secure listeners
+// are the ones players may log in over when -secure-login is set.
+//
+func acceptLoop(ln net.Listener, secure bool) {
+	for {
+		conn, err := ln.Accept()
+
+		if errors.Is(err, net.ErrClosed) {
+			return
 		}
-	}
 
-	infoLog.Println("Disconnection from", conn.RemoteAddr())
+		if err != nil {
+			errorLog.Println("Could not accept connection:", err)
+			continue
+		}
 
-	if client.player != nil {
-		world.TellAllButMe(client.player, client.player.name+" has disconnected.")
-		client.player.awake = false
-		client.player.client = nil
-		client.player = nil
-	}
+		infoLog.Println("Accepted connection from:", conn.RemoteAddr())
+
+		client := NewClient(conn)
+		client.secure = secure
 
-	conn.Close()
+		go connectionLoop(client)
+	}
 }
 
 //
@@ -264,10 +614,10 @@ func initWorld() {
 	helm, _ := world.NewRoom("Wizard's Helm")
 
 	wizard, _ := world.NewPlayer("Wizard", "xyzzy", helm)
-	wizard.SetFlag(WizardFlag)
-	wizard.SetFlag(BuilderFlag)
+	world.SetFlag(wizard, WizardFlag)
+	world.SetFlag(wizard, BuilderFlag)
 
-	helm.owner = wizard
+	world.SetOwner(helm, wizard)
 }
 
 func init() {
@@ -280,6 +630,43 @@ func init() {
 // Main entry point
 //
 func main() {
+	certFile := flag.String("tls-cert", "", "TLS certificate file; enables the TLS listener")
+	keyFile := flag.String("tls-key", "", "TLS private key file")
+	genCert := flag.String("gen-cert", "", "Write a self-signed certificate for these comma separated hosts to -tls-cert and -tls-key, and exit")
+	flag.BoolVar(&secureLogin, "secure-login", false, "Only allow players to log in over TLS")
+	keyPolicy := flag.String("key-policy", "tombstone", "What to do with the keys of destroyed objects: tombstone or recycle")
+	sshHostKey := flag.String("ssh-host-key", "", "SSH host key file, created if missing; enables the SSH listener")
+	web := flag.Bool("web", true, "Serve the web client and its WebSocket endpoint")
+	overflow := flag.String("output-overflow", "drop", "What to do when a client can't keep up with its output: drop or disconnect")
+	flag.Parse()
+
+	if *genCert != "" {
+		if *certFile == "" || *keyFile == "" {
+			errorLog.Println("-gen-cert needs -tls-cert and -tls-key")
+			return
+		}
+
+		if err := generateCertificate(*certFile, *keyFile, strings.Split(*genCert, ",")); err != nil {
+			errorLog.Println("Could not generate certificate:", err)
+			return
+		}
+
+		infoLog.Println("Wrote", *certFile, "and", *keyFile)
+		return
+	}
+
+	policy, err := ParseKeyPolicy(*keyPolicy)
+
+	if err != nil {
+		errorLog.Println(err)
+		return
+	}
+
+	if outputOverflow, err = ParseOverflowPolicy(*overflow); err != nil {
+		errorLog.Println(err)
+		return
+	}
+
 	// Set up the SIGTERM signal handler
 	sigs := make(chan os.Signal, 2)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
@@ -293,7 +680,64 @@ func main() {
 
 	infoLog.Println("Loading world...")
 
-	initWorld()
+	if _, err := os.Stat(WORLDFILE); os.IsNotExist(err) {
+		infoLog.Println("No saved world found, building a new one.")
+		initWorld()
+	} else {
+		loaded, err := LoadWorld(WORLDFILE)
+
+		if err != nil {
+			errorLog.Println("Could not load world:", err)
+			return
+		}
+
+		world = loaded
+
+		replayed, err := ReplayJournal(world, JOURNALFILE)
+
+		if err != nil {
+			errorLog.Println("Could not replay journal:", err)
+			return
+		}
+
+		infoLog.Println("Replayed", replayed, "journal entries")
+	}
+
+	world.keyPolicy = policy
+
+	journal, err := OpenJournal(JOURNALFILE)
+
+	if err != nil {
+		errorLog.Println("Could not open journal:", err)
+		return
+	}
+
+	world.journal = journal
+
+	// Fold anything we just replayed into a fresh snapshot, so the
+	// journal only ever holds changes made since the last one.
+	if err := world.Checkpoint(WORLDFILE); err != nil {
+		errorLog.Println("Could not save world:", err)
+		return
+	}
+
+	go func() {
+		for range time.Tick(CHECKPOINT_INTERVAL) {
+			world.Do(func(w *World) {
+				if err := w.Checkpoint(WORLDFILE); err != nil {
+					errorLog.Println("Could not checkpoint world:", err)
+				}
+			})
+		}
+	}()
+
+	stopWorld := make(chan struct{})
+	worldStopped := make(chan struct{})
+
+	go func() {
+		world.Run(TICK, stopWorld)
+		close(worldStopped)
+	}()
 
 	infoLog.Println("World initialized with",
 		len(world.rooms), "room(s),",
@@ -311,24 +755,61 @@ func main() {
 
 	infoLog.Println("Server listening on port", PORT)
 
-	go func() {
-		for {
-			conn, err := ln.Accept()
+	if *certFile != "" && *keyFile != "" {
+		tlsLn, err := listenTLS(TLSPORT, *certFile, *keyFile)
+
+		if err != nil {
+			errorLog.Println("Could not start TLS server:", err)
+			return
+		}
+
+		infoLog.Println("TLS server listening on port", TLSPORT)
+
+		go acceptLoop(tlsLn, true)
+	} else if secureLogin {
+		errorLog.Println("-secure-login needs -tls-cert and -tls-key")
+		return
+	}
+
+	if *sshHostKey != "" {
+		if err := listenSSH(SSHPORT, *sshHostKey); err != nil {
+			errorLog.Println("Could not start SSH server:", err)
+			return
+		}
 
-			infoLog.Println("Accepted connection from:", conn.RemoteAddr())
+		infoLog.Println("SSH server listening on port", SSHPORT)
+	}
+
+	if *web {
+		go func() {
+			infoLog.Println("Web client listening on port", WEBPORT)
+
+			err := http.ListenAndServe(fmt.Sprintf(":%d", WEBPORT), webHandler())
 
 			if err != nil {
-				errorLog.Println("Could not accept connection:", err)
-				continue
+				errorLog.Println("Could not start web server:", err)
 			}
+		}()
+	}
 
-			go connectionLoop(conn)
-		}
-	}()
+	go acceptLoop(ln, false)
 
 	<-stopRequested
 
 	// Notify all clients, clean up resources, etc.
 
+	// Once the world's goroutine has stopped nothing else can change
+	// the world, so it's safe to save.
+	close(stopWorld)
+	<-worldStopped
+
+	infoLog.Println("Saving world...")
+
+	if err := world.Checkpoint(WORLDFILE); err != nil {
+		errorLog.Println("Could not save world:", err)
+	}
+
+	journal.Close()
+
 	infoLog.Println("Shutdown complete. Goodbye!")
 }
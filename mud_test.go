@@ -2,8 +2,11 @@ package main
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"net"
 	"regexp"
+	"sync"
 	"testing"
 	"time"
 )
@@ -26,11 +29,16 @@ type MockConn struct {
 	readError        *error
 	closeAfterWrites int
 	numWrites        int
+	numReads         int
 }
 
-func (conn MockConn) Read(b []byte) (n int, err error) {
-	read := copy(b, conn.readBytes[conn.numWrites])
-	conn.numWrites++
+func (conn *MockConn) Read(b []byte) (n int, err error) {
+	if conn.numReads >= len(conn.readBytes) {
+		return 0, io.EOF
+	}
+
+	read := copy(b, conn.readBytes[conn.numReads])
+	conn.numReads++
 	return read, nil
 }
 
@@ -45,11 +53,11 @@ func (conn MockConn) Close() error {
 }
 
 func (conn MockConn) LocalAddr() net.Addr {
-	return &net.IPAddr{net.IPv4(192, 168, 1, 1), ""}
+	return &net.IPAddr{IP: net.IPv4(192, 168, 1, 1)}
 }
 
 func (conn MockConn) RemoteAddr() net.Addr {
-	return &net.IPAddr{net.IPv4(192, 168, 1, 1), ""}
+	return &net.IPAddr{IP: net.IPv4(192, 168, 1, 1)}
 }
 
 func (conn MockConn) SetDeadline(t time.Time) error {
@@ -66,7 +74,7 @@ func (conn MockConn) SetWriteDeadline(t time.Time) error {
 
 func NewMockConn() *MockConn {
 	buffer := bytes.NewBuffer(make([]byte, 1024, 1024))
-	return &MockConn{readBytes: make([][]byte, 1024, 1024), writeBuffer: buffer}
+	return &MockConn{readBytes: make([][]byte, 0), writeBuffer: buffer}
 }
 
 // Automatically convert writtenBytes into a string
@@ -331,6 +339,18 @@ func TestMovePlayer(t *testing.T) {
 	}
 }
 
+func TestMovePlayerWithinRoom(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+
+	world.MovePlayer(bob, hall)
+
+	if bob.location != hall || hall.players[bob.key] != bob {
+		t.Errorf("Expected bob to still be in the hall")
+	}
+}
+
 func TestFlags(t *testing.T) {
 	world := NewWorld()
 	hall, _ := world.NewRoom("The Hall")
@@ -368,3 +388,108 @@ func TestFlags(t *testing.T) {
 		t.Errorf("Bob should not have builder bit set")
 	}
 }
+
+func TestTellWrapsToClientWidth(t *testing.T) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+	client := NewClient(conn)
+	client.width = 20
+
+	client.Tell("The quick brown fox jumps over the lazy dog.")
+
+	expected := "The quick brown fox\r\njumps over the lazy\r\ndog.\r\n"
+
+	if conn.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, conn.String())
+	}
+}
+
+var runWorld sync.Once
+
+//
+// Start the global world's goroutine, for tests that go through
+// connectionLoop. It runs until the tests finish.
+//
+func runGlobalWorld() {
+	runWorld.Do(func() { go world.Run(time.Millisecond, nil) })
+}
+
+func TestConcurrentClients(t *testing.T) {
+	runGlobalWorld()
+
+	const walkers = 8
+
+	var hall, den *Room
+	var players []*Player
+	var names []string
+
+	world.Do(func(w *World) {
+		hall, _ = w.NewRoom("Crossing Hall")
+		den, _ = w.NewRoom("Crossing Den")
+		w.NewExit(hall, "east", den)
+		w.NewExit(den, "west", hall)
+
+		for i := 0; i < walkers; i++ {
+			start := hall
+			if i%2 == 1 {
+				start = den
+			}
+
+			// The global world outlives the test, so use new names
+			// each time it runs.
+			name := fmt.Sprintf("walker%dx%d", hall.key, i)
+			p, _ := w.NewPlayer(name, "foo", start)
+			players = append(players, p)
+			names = append(names, name)
+		}
+	})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < walkers; i++ {
+		server, browser := net.Pipe()
+
+		wg.Add(1)
+
+		go func() {
+			connectionLoop(NewPlainClient(server))
+			wg.Done()
+		}()
+
+		go io.Copy(io.Discard, browser)
+
+		// Half the walkers start in each room, so they keep crossing
+		// each other between the two.
+		go func(i int) {
+			fmt.Fprintf(browser, "connect %s foo\r\n", names[i])
+
+			for j := 0; j < 25; j++ {
+				if i%2 == 0 {
+					io.WriteString(browser, "east\r\nsay hi\r\nwest\r\nwho\r\n")
+				} else {
+					io.WriteString(browser, "west\r\nsay hi\r\neast\r\nwho\r\n")
+				}
+			}
+
+			io.WriteString(browser, "quit\r\n")
+		}(i)
+	}
+
+	wg.Wait()
+
+	world.Do(func(w *World) {
+		if len(hall.players)+len(den.players) != walkers {
+			t.Errorf("Expected %d players between the rooms, found %d", walkers, len(hall.players)+len(den.players))
+		}
+
+		for _, p := range players {
+			if p.client != nil {
+				t.Errorf("Expected %s to be disconnected", p.name)
+			}
+
+			if p.location.players[p.key] != p {
+				t.Errorf("Expected %s to be in %s", p.name, p.location.name)
+			}
+		}
+	})
+}
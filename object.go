@@ -2,7 +2,6 @@ package main
 
 import (
 	"strings"
-	"sync"
 )
 
 type Flags uint
@@ -12,13 +11,15 @@ const (
 	WizardFlag     Flags = 1 << iota
 	BuilderFlag          = 1 << iota
 	ProgrammerFlag       = 1 << iota
+	HiddenFlag           = 1 << iota
+	ContainerFlag        = 1 << iota
+	ClosedFlag           = 1 << iota
 )
 
 //
 // Everything in the world is an Object.
 //
 type Object struct {
-	sync.RWMutex
 	// Every object in the database has a unique key. No two objects
 	// have the same key.
 	key int
@@ -36,6 +37,14 @@ type Object struct {
 
 	// Player flags
 	flags Flags
+
+	// Who may use the object, or nil if anyone may, and what to tell
+	// those who can't.
+	lock        LockExpr
+	failMessage string
+
+	// Builders' own named values, for scripts and messages.
+	attrs Attributes
 }
 
 //
@@ -53,6 +62,16 @@ type Objecter interface {
 	SetFlag(f Flags)
 	ClearFlag(f Flags)
 	IsSet(f Flags) bool
+	LockExpr() LockExpr
+	SetLockExpr(l LockExpr)
+	Passes(p *Player) bool
+	FailMessage() string
+	SetFailMessage(s string)
+	Attribute(name string) (Attribute, bool)
+	Attributes() []Attribute
+	SetAttribute(name string, value string)
+	ClearAttribute(name string)
+	SetAttributeFlags(name string, f AttrFlags)
 }
 
 //
@@ -97,13 +116,34 @@ func (o *Object) SetOwner(p *Player) {
 }
 
 func (o *Object) SetFlag(f Flags) {
-	o.flags = (f | BuilderFlag)
+	o.flags |= f
 }
 
 func (o *Object) ClearFlag(f Flags) {
-	o.flags ^= (f | BuilderFlag)
+	o.flags &^= f
 }
 
 func (o *Object) IsSet(f Flags) bool {
 	return (o.flags & f) != 0
 }
+
+func (o *Object) LockExpr() LockExpr {
+	return o.lock
+}
+
+func (o *Object) SetLockExpr(l LockExpr) {
+	o.lock = l
+}
+
+// Can the player get past the object's lock?
+func (o *Object) Passes(p *Player) bool {
+	return o.lock == nil || o.lock.Passes(p)
+}
+
+func (o *Object) FailMessage() string {
+	return o.failMessage
+}
+
+func (o *Object) SetFailMessage(s string) {
+	o.failMessage = s
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+//
+// What to do with a client whose output queue fills up, because it
+// isn't reading what we send as fast as we send it.
+//
+type OverflowPolicy uint8
+
+const (
+	// Throw output away until the client catches up, then tell the
+	// player they missed some.
+	DropOutput OverflowPolicy = iota
+	// Disconnect the client.
+	DisconnectOnOverflow
+)
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch s {
+	case "drop":
+		return DropOutput, nil
+	case "disconnect":
+		return DisconnectOnOverflow, nil
+	}
+
+	return DropOutput, fmt.Errorf("Unknown overflow policy '%s'", s)
+}
+
+//
+// Output waiting to be sent to a client. The world's goroutine adds
+// to it without ever waiting on the network, and the client's writer
+// goroutine sends it on, so a slow client only holds up itself.
+//
+type outputQueue struct {
+	sync.Mutex
+	conn    net.Conn
+	pending [][]byte
+	// Bytes queued and not yet written, and how many there may be
+	size   int
+	limit  int
+	policy OverflowPolicy
+	closed bool
+	// The connection failed, or we gave up on it
+	aborted bool
+	// Pinged when there's output to send, or the queue is closed
+	wake chan struct{}
+}
+
+func newOutputQueue(conn net.Conn, limit int, policy OverflowPolicy) *outputQueue {
+	return &outputQueue{conn: conn, limit: limit, policy: policy, wake: make(chan struct{}, 1)}
+}
+
+//
+// Queue output. This never refuses output for want of room, since
+// telnet commands and compressed data can't be dropped part way
+// through; Client.Tell checks for room before it writes anything.
+//
+func (q *outputQueue) Write(b []byte) (int, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.closed {
+		return 0, net.ErrClosed
+	}
+
+	q.pending = append(q.pending, append([]byte(nil), b...))
+	q.size += len(b)
+	q.signal()
+
+	return len(b), nil
+}
+
+func (q *outputQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// How many bytes are waiting to be written.
+func (q *outputQueue) Buffered() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.size
+}
+
+//
+// Stop taking output. The connection is closed once everything
+// already queued has been sent.
+//
+func (q *outputQueue) Close() error {
+	q.Lock()
+	defer q.Unlock()
+
+	q.closed = true
+	q.signal()
+
+	return nil
+}
+
+//
+// Give up on the connection: throw away whatever's queued and close
+// it, which ends the client's connectionLoop, and with it the
+// player's session. Closing happens in the background, since a
+// stalled connection can take a while to let go.
+//
+func (q *outputQueue) abort() {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.aborted {
+		return
+	}
+
+	q.closed, q.aborted = true, true
+	q.pending, q.size = nil, 0
+	q.signal()
+
+	go q.conn.Close()
+}
+
+//
+// Send queued output until the queue is closed and empty, then close
+// the connection. Runs on the client's writer goroutine.
+//
+func (q *outputQueue) drain() {
+	for range q.wake {
+		q.Lock()
+		pending, closed, aborted := q.pending, q.closed, q.aborted
+		q.pending = nil
+		q.Unlock()
+
+		if aborted {
+			return
+		}
+
+		for _, b := range pending {
+			if _, err := q.conn.Write(b); err != nil {
+				infoLog.Println("Could not write to", q.conn.RemoteAddr(), err)
+				q.abort()
+				return
+			}
+
+			q.Lock()
+			q.size -= len(b)
+			q.Unlock()
+		}
+
+		if closed {
+			q.conn.Close()
+			return
+		}
+	}
+}
+
+//
+// Is there room for more output? If not, the client is dealt with as
+// its queue's policy says. Once output has been dropped, none is sent
+// until the queue has half emptied, so the player gets a useful
+// amount at a time rather than the odd line.
+//
+func (c *Client) roomForOutput() bool {
+	q := c.output
+
+	if q == nil {
+		return true
+	}
+
+	buffered := q.Buffered()
+
+	if c.droppedOutput && buffered <= q.limit/2 {
+		c.droppedOutput = false
+		c.telnet.Write([]byte("*** Some output was dropped because your connection couldn't keep up. ***\r\n"))
+	}
+
+	if !c.droppedOutput && buffered < q.limit {
+		return true
+	}
+
+	if q.policy == DisconnectOnOverflow {
+		infoLog.Println("Disconnecting", c.conn.RemoteAddr(), "because it isn't keeping up with output")
+		q.abort()
+	} else {
+		c.droppedOutput = true
+	}
+
+	return false
+}
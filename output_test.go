@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A client whose output goes through a small queue to the far end of
+// a pipe, which the test reads from, or not.
+func newQueuedClient(limit int, policy OverflowPolicy) (*Client, net.Conn) {
+	server, browser := net.Pipe()
+	client := NewPlainClient(server)
+
+	client.output = newOutputQueue(server, limit, policy)
+	client.telnet.out = client.output
+	go client.output.drain()
+
+	return client, browser
+}
+
+// Wait for the queue to be written out, as far as the pipe will take it.
+func waitForDrain(t *testing.T, q *outputQueue) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for q.Buffered() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the queue to drain, %d bytes left", q.Buffered())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	if p, err := ParseOverflowPolicy("disconnect"); p != DisconnectOnOverflow || err != nil {
+		t.Errorf("Expected disconnect, got %v (%v)", p, err)
+	}
+
+	if _, err := ParseOverflowPolicy("explode"); err == nil {
+		t.Errorf("Expected an unknown policy to be refused")
+	}
+}
+
+func TestQueuedOutputIsSentThenClosed(t *testing.T) {
+	client, browser := newQueuedClient(1024, DropOutput)
+
+	client.Tell("Hello.")
+	client.Tell("Goodbye.")
+	client.Close()
+
+	out, err := io.ReadAll(browser)
+
+	if err != nil || string(out) != "Hello.\r\nGoodbye.\r\n" {
+		t.Errorf("Unexpected output %q (%v)", out, err)
+	}
+}
+
+func TestStalledClientDoesntBlockTell(t *testing.T) {
+	client, browser := newQueuedClient(64, DropOutput)
+	defer browser.Close()
+
+	done := make(chan bool)
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			client.Tell("Nobody is reading this.")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected Tell not to wait for a stalled client")
+	}
+
+	if client.output.Buffered() > 64+len("Nobody is reading this.\r\n") {
+		t.Errorf("Expected the queue to stay bounded, holds %d bytes", client.output.Buffered())
+	}
+}
+
+func TestOverflowDropsWithNotice(t *testing.T) {
+	client, browser := newQueuedClient(64, DropOutput)
+	defer browser.Close()
+
+	for i := 0; i < 20; i++ {
+		client.Tell("Line of output.")
+	}
+
+	if !client.droppedOutput {
+		t.Fatalf("Expected output to be dropped")
+	}
+
+	lines := make(chan string, 100)
+
+	go func() {
+		reader := bufio.NewReader(browser)
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+
+	waitForDrain(t, client.output)
+	client.Tell("Caught up.")
+
+	var got []string
+
+	for line := range lines {
+		got = append(got, line)
+
+		if line == "Caught up." {
+			break
+		}
+	}
+
+	if len(got) < 3 || len(got) > 10 {
+		t.Fatalf("Expected some lines to be dropped, got %q", got)
+	}
+
+	if !strings.Contains(got[len(got)-2], "output was dropped") {
+		t.Errorf("Expected to be told output was dropped, got %q", got)
+	}
+}
+
+func TestOverflowCanDisconnect(t *testing.T) {
+	client, browser := newQueuedClient(64, DisconnectOnOverflow)
+	defer browser.Close()
+
+	for i := 0; i < 20; i++ {
+		client.Tell("Line of output.")
+	}
+
+	browser.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.ReadAll(browser); err != nil {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+}
+
+// A connection whose writes can be made to fail.
+type breakableConn struct {
+	net.Conn
+	broken atomic.Bool
+}
+
+func (c *breakableConn) Write(b []byte) (int, error) {
+	if c.broken.Load() {
+		return 0, errors.New("Broken pipe")
+	}
+
+	return c.Conn.Write(b)
+}
+
+func TestWriteErrorDisconnectsPlayer(t *testing.T) {
+	runGlobalWorld()
+
+	var bob *Player
+	var name string
+
+	world.Do(func(w *World) {
+		hall, _ := w.NewRoom("Breakable Hall")
+		name = fmt.Sprintf("breakable%d", hall.key)
+		bob, _ = w.NewPlayer(name, "foo", hall)
+	})
+
+	server, browser := net.Pipe()
+	defer browser.Close()
+
+	conn := &breakableConn{Conn: server}
+	finished := make(chan bool)
+
+	go func() {
+		connectionLoop(NewPlainClient(conn))
+		close(finished)
+	}()
+
+	go io.Copy(io.Discard, browser)
+
+	fmt.Fprintf(browser, "connect %s foo\r\n", name)
+
+	connected := false
+
+	for !connected {
+		world.Do(func(w *World) { connected = bob.client != nil })
+	}
+
+	conn.broken.Store(true)
+	io.WriteString(browser, "look\r\n")
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a write error to end the connection")
+	}
+
+	world.Do(func(w *World) {
+		if bob.client != nil {
+			t.Errorf("Expected bob to be disconnected")
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//
+// Passwords are stored as salted PBKDF2-SHA256 hashes, in the form
+//
+//   pbkdf2-sha256$<iterations>$<salt>$<hash>
+//
+// with the salt and hash in unpadded base64. Older worlds stored a
+// bare hex SHA-512 of the password. Those are still accepted, and
+// replaced with a new hash the next time the player logs in.
+//
+
+const passwordScheme = "pbkdf2-sha256"
+const passwordSaltLength = 16
+const passwordKeyLength = 32
+
+// How many rounds of PBKDF2 new hashes use. Raising this makes
+// existing hashes get upgraded as players log in.
+var passwordIterations = 600000
+
+func hashPassword(raw string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, raw, salt, passwordIterations, passwordKeyLength)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+//
+// A parsed password hash. Legacy hashes have no salt, and zero
+// iterations.
+//
+type passwordHash struct {
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func parsePasswordHash(s string) (passwordHash, error) {
+	if !strings.Contains(s, "$") {
+		key, err := hex.DecodeString(s)
+
+		if err != nil || len(key) != sha512.Size {
+			return passwordHash{}, errors.New("Bad password hash")
+		}
+
+		return passwordHash{key: key}, nil
+	}
+
+	fields := strings.Split(s, "$")
+
+	if len(fields) != 4 || fields[0] != passwordScheme {
+		return passwordHash{}, errors.New("Unknown password hash scheme")
+	}
+
+	iterations, err := strconv.Atoi(fields[1])
+
+	if err != nil || iterations < 1 {
+		return passwordHash{}, errors.New("Bad password hash iterations")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(fields[2])
+
+	if err != nil || len(salt) == 0 {
+		return passwordHash{}, errors.New("Bad password hash salt")
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(fields[3])
+
+	if err != nil || len(key) == 0 {
+		return passwordHash{}, errors.New("Bad password hash")
+	}
+
+	return passwordHash{iterations: iterations, salt: salt, key: key}, nil
+}
+
+func (h passwordHash) legacy() bool {
+	return h.iterations == 0
+}
+
+// Was the hash made with an old scheme, or fewer iterations than we
+// use now?
+func (h passwordHash) outdated() bool {
+	return h.legacy() || h.iterations < passwordIterations
+}
+
+// Does the password match? The comparison takes the same time
+// however much of the hash matches.
+func (h passwordHash) matches(raw string) bool {
+	var key []byte
+
+	if h.legacy() {
+		sum := sha512.Sum512([]byte(raw))
+		key = sum[:]
+	} else {
+		var err error
+		key, err = pbkdf2.Key(sha256.New, raw, h.salt, h.iterations, len(h.key))
+
+		if err != nil {
+			return false
+		}
+	}
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+//
+// Check a password against a stored hash. If it matches but the hash
+// is out of date, a new one is made to replace it. Both take a good
+// fraction of a second on purpose, so this is run away from the
+// world's goroutine; see World.UpgradePassword for storing the result.
+//
+func checkPassword(stored string, raw string) (ok bool, upgraded string) {
+	hash, err := parsePasswordHash(stored)
+
+	if err != nil || !hash.matches(raw) {
+		return false, ""
+	}
+
+	if !hash.outdated() {
+		return true, ""
+	}
+
+	upgraded, err = hashPassword(raw)
+
+	if err != nil {
+		errorLog.Println("Could not upgrade password hash:", err)
+		return true, ""
+	}
+
+	return true, upgraded
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Real iteration counts make every NewPlayer take a noticeable
+// fraction of a second. The tests don't need them.
+func init() {
+	passwordIterations = 1000
+}
+
+func legacyHash(raw string) string {
+	sum := sha512.Sum512([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// A hash with as many iterations as a real one, so it takes a while
+// to check.
+func slowHash(raw string) string {
+	const iterations = 600000
+	salt := []byte("a pinch of salt")
+	key, _ := pbkdf2.Key(sha256.New, raw, salt, iterations, passwordKeyLength)
+
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestHashPasswordIsSalted(t *testing.T) {
+	a, _ := hashPassword("xyzzy")
+	b, _ := hashPassword("xyzzy")
+
+	if !strings.HasPrefix(a, "pbkdf2-sha256$1000$") {
+		t.Errorf("Unexpected hash format %q", a)
+	}
+
+	if a == b {
+		t.Errorf("Expected two hashes of the same password to differ")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, _ := hashPassword("xyzzy")
+
+	ok, upgraded := checkPassword(hash, "xyzzy")
+
+	if !ok {
+		t.Errorf("Expected the right password to match")
+	}
+
+	if upgraded != "" {
+		t.Errorf("Expected a fresh hash not to need an upgrade")
+	}
+
+	if ok, _ := checkPassword(hash, "plugh"); ok {
+		t.Errorf("Expected the wrong password not to match")
+	}
+
+	if ok, _ := checkPassword(hash, ""); ok {
+		t.Errorf("Expected an empty password not to match")
+	}
+}
+
+func TestCheckPasswordAcceptsLegacyHashes(t *testing.T) {
+	ok, upgraded := checkPassword(legacyHash("xyzzy"), "xyzzy")
+
+	if !ok {
+		t.Errorf("Expected a legacy hash to be checked")
+	}
+
+	if !strings.HasPrefix(upgraded, "pbkdf2-sha256$") {
+		t.Errorf("Expected a legacy hash to be upgraded, got %q", upgraded)
+	}
+
+	if ok, upgraded := checkPassword(legacyHash("xyzzy"), "plugh"); ok || upgraded != "" {
+		t.Errorf("Expected the wrong password not to match, or be upgraded")
+	}
+}
+
+func TestMoreIterationsNeedUpgrade(t *testing.T) {
+	hash, _ := hashPassword("xyzzy")
+
+	passwordIterations *= 2
+	defer func() { passwordIterations /= 2 }()
+
+	if _, upgraded := checkPassword(hash, "xyzzy"); upgraded == "" {
+		t.Errorf("Expected a hash with fewer iterations to need an upgrade")
+	}
+}
+
+func TestParsePasswordHashRejectsGarbage(t *testing.T) {
+	bad := []string{
+		"",
+		"abcd",
+		"md5$1$c2FsdA$a2V5",
+		"pbkdf2-sha256$0$c2FsdA$a2V5",
+		"pbkdf2-sha256$many$c2FsdA$a2V5",
+		"pbkdf2-sha256$1000$$a2V5",
+		"pbkdf2-sha256$1000$c2FsdA",
+	}
+
+	for _, s := range bad {
+		if _, err := parsePasswordHash(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestConnectUpgradesLegacyPassword(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "world.json")
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	bob.password = legacyHash("foo")
+	world.Save(snapshot)
+
+	loaded, err := LoadWorld(snapshot)
+
+	if err != nil {
+		t.Fatalf("Expected a world with legacy hashes to load: %s", err)
+	}
+
+	path := openTestJournal(t, loaded)
+	bob = loaded.players[bob.key]
+
+	client := NewClient(NewMockConn())
+	doConnect(loaded, client, Command{"connect", "", "bob foo"})
+
+	if client.player != bob {
+		t.Fatalf("Expected bob to connect with a legacy password")
+	}
+
+	if !strings.HasPrefix(bob.password, "pbkdf2-sha256$") {
+		t.Errorf("Expected bob's password to be upgraded, got %q", bob.password)
+	}
+
+	// The upgrade must survive a crash before the next checkpoint.
+	replayed, _ := LoadWorld(snapshot)
+
+	if _, err := ReplayJournal(replayed, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	if replayed.players[bob.key].password != bob.password {
+		t.Errorf("Expected the upgraded password to be journaled")
+	}
+}
+
+func TestSlowLoginDoesntHoldUpOthers(t *testing.T) {
+	runGlobalWorld()
+
+	hash := slowHash("foo")
+
+	var slow, quick *Player
+
+	world.Do(func(w *World) {
+		hall, _ := w.NewRoom("Waiting Room")
+		slow, _ = w.NewPlayerWithHash(fmt.Sprintf("slow%d", hall.key), hash, hall)
+		quick, _ = w.NewPlayer(fmt.Sprintf("quick%d", hall.key), "foo", hall)
+	})
+
+	slowServer, slowBrowser := net.Pipe()
+	quickServer, quickBrowser := net.Pipe()
+	defer slowBrowser.Close()
+	defer quickBrowser.Close()
+
+	slowClient := NewPlainClient(slowServer)
+
+	go connectionLoop(slowClient)
+	go connectionLoop(NewPlainClient(quickServer))
+	go io.Copy(io.Discard, slowBrowser)
+
+	lines := make(chan string)
+
+	go func() {
+		reader := bufio.NewReader(quickBrowser)
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+
+	// What slow says must wait until the password has been checked.
+	fmt.Fprintf(slowBrowser, "connect %s foo\r\nsay Sorry I'm late.\r\n", slow.name)
+
+	deadline := time.Now().Add(5 * time.Second)
+	waiting := false
+
+	for !waiting {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s's password to be checked in the background", slow.name)
+		}
+
+		world.Do(func(w *World) { waiting = slowClient.waiting })
+	}
+
+	fmt.Fprintf(quickBrowser, "connect %s foo\r\n", quick.name)
+
+	connected := false
+
+	for !connected {
+		world.Do(func(w *World) {
+			connected = quick.client != nil
+
+			if connected && slow.client != nil {
+				t.Errorf("Expected %s to connect before %s's password was checked", quick.name, slow.name)
+			}
+		})
+	}
+
+	want := fmt.Sprintf("%s says, \"Sorry I'm late.\"", slow.name)
+	timeout := time.After(30 * time.Second)
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("Expected to hear from %s", slow.name)
+			}
+
+			if line == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Expected %s to connect and speak", slow.name)
+		}
+	}
+}
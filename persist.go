@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+//
+// The version of the on-disk world format. Bump this whenever the
+// layout changes in a way that older code can't read, and teach
+// decodeWorld how to upgrade from the previous version.
+//
+const WorldVersion = 1
+
+//
+// The saved forms of everything in the world. Pointers between
+// objects are flattened to keys, and resolved again on load.
+//
+type savedObject struct {
+	Key         int         `json:"key"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Owner       int         `json:"owner,omitempty"`
+	Flags       Flags       `json:"flags,omitempty"`
+	Lock        string      `json:"lock,omitempty"`
+	Fail        string      `json:"fail,omitempty"`
+	Attrs       []savedAttr `json:"attrs,omitempty"`
+}
+
+type savedAttr struct {
+	Name  string    `json:"name"`
+	Value string    `json:"value"`
+	Flags AttrFlags `json:"flags,omitempty"`
+}
+
+type savedRoom struct {
+	savedObject
+	Exits []int `json:"exits,omitempty"`
+}
+
+type savedExit struct {
+	savedObject
+	Destination int               `json:"destination"`
+	Messages    map[string]string `json:"messages,omitempty"`
+}
+
+type savedPlayer struct {
+	savedObject
+	Password   string   `json:"password"`
+	Location   int      `json:"location"`
+	PublicKeys []string `json:"publicKeys,omitempty"`
+}
+
+type savedThing struct {
+	savedObject
+	Location int `json:"location"`
+	Capacity int `json:"capacity,omitempty"`
+}
+
+type savedWorld struct {
+	Version  int           `json:"version"`
+	LastKey  int           `json:"lastKey"`
+	Rooms    []savedRoom   `json:"rooms"`
+	Exits    []savedExit   `json:"exits"`
+	Players  []savedPlayer `json:"players"`
+	Things   []savedThing  `json:"things,omitempty"`
+	FreeKeys []int         `json:"freeKeys,omitempty"`
+}
+
+func saveObject(o *Object) savedObject {
+	s := savedObject{Key: o.key, Name: o.name, Description: o.description, Flags: o.flags,
+		Fail: o.failMessage}
+
+	if o.owner != nil {
+		s.Owner = o.owner.key
+	}
+
+	if o.lock != nil {
+		s.Lock = o.lock.String()
+	}
+
+	for _, a := range o.Attributes() {
+		s.Attrs = append(s.Attrs, savedAttr{Name: a.Name, Value: a.Value, Flags: a.Flags})
+	}
+
+	return s
+}
+
+//
+// Write the world out to the given path. The world is written to a
+// temporary file, synced to disk, and renamed into place, and the
+// rename is synced too, so neither a crash nor losing power part way
+// through a save leaves a truncated world behind.
+//
+func (w *World) Save(path string) error {
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err = w.encode(f); err == nil {
+		err = f.Sync()
+	}
+
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// Make a rename in the directory survive the machine going down.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+func (w *World) encode(out io.Writer) error {
+	saved := savedWorld{Version: WorldVersion}
+
+	for _, r := range w.rooms {
+		sr := savedRoom{savedObject: saveObject(&r.Object)}
+		for key := range r.exits {
+			sr.Exits = append(sr.Exits, key)
+		}
+		sort.Ints(sr.Exits)
+		saved.Rooms = append(saved.Rooms, sr)
+	}
+
+	for _, e := range w.exits {
+		se := savedExit{savedObject: saveObject(&e.Object), Messages: e.messages}
+		if e.destination != nil {
+			se.Destination = e.destination.key
+		}
+		saved.Exits = append(saved.Exits, se)
+	}
+
+	for _, p := range w.players {
+		sp := savedPlayer{savedObject: saveObject(&p.Object), Password: p.password,
+			PublicKeys: p.publicKeys}
+		if p.location != nil {
+			sp.Location = p.location.key
+		}
+		saved.Players = append(saved.Players, sp)
+	}
+
+	for _, t := range w.things {
+		st := savedThing{savedObject: saveObject(&t.Object), Capacity: t.capacity}
+		if t.location != nil {
+			st.Location = t.location.Key()
+		}
+		saved.Things = append(saved.Things, st)
+	}
+
+	// Keep the output in key order, so that saves of the same world
+	// are identical and diff cleanly.
+	sort.Slice(saved.Rooms, func(i, j int) bool { return saved.Rooms[i].Key < saved.Rooms[j].Key })
+	sort.Slice(saved.Exits, func(i, j int) bool { return saved.Exits[i].Key < saved.Exits[j].Key })
+	sort.Slice(saved.Players, func(i, j int) bool { return saved.Players[i].Key < saved.Players[j].Key })
+	sort.Slice(saved.Things, func(i, j int) bool { return saved.Things[i].Key < saved.Things[j].Key })
+
+	saved.LastKey = w.lastKey()
+	saved.FreeKeys = w.freeKeys
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&saved)
+}
+
+//
+// Read a world previously written by Save.
+//
+func LoadWorld(path string) (*World, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return decodeWorld(f)
+}
+
+func decodeWorld(in io.Reader) (*World, error) {
+	var saved savedWorld
+
+	if err := json.NewDecoder(in).Decode(&saved); err != nil {
+		return nil, err
+	}
+
+	if saved.Version != WorldVersion {
+		return nil, fmt.Errorf("Unsupported world version %d", saved.Version)
+	}
+
+	w := NewWorld()
+
+	// First pass: create every object, so that keys can be resolved
+	// no matter what order things were saved in.
+
+	for _, sr := range saved.Rooms {
+		r := &Room{exits: make(map[int]*Exit), players: make(map[int]*Player)}
+		if err := loadObject(&r.Object, sr.savedObject); err != nil {
+			return nil, err
+		}
+		w.rooms[sr.Key] = r
+	}
+
+	for _, se := range saved.Exits {
+		e := &Exit{}
+		if err := loadObject(&e.Object, se.savedObject); err != nil {
+			return nil, err
+		}
+
+		for kind, msg := range se.Messages {
+			if !isExitMessage(kind) {
+				return nil, fmt.Errorf("Exit #%d has unknown message '%s'", se.Key, kind)
+			}
+			e.SetMessage(kind, msg)
+		}
+		w.exits[se.Key] = e
+	}
+
+	for _, sp := range saved.Players {
+		if _, err := parsePasswordHash(sp.Password); err != nil {
+			return nil, fmt.Errorf("Bad password hash for player #%d", sp.Key)
+		}
+
+		p := &Player{password: sp.Password}
+		if err := loadObject(&p.Object, sp.savedObject); err != nil {
+			return nil, err
+		}
+		p.publicKeys = sp.PublicKeys
+
+		w.players[sp.Key] = p
+	}
+
+	for _, st := range saved.Things {
+		t := &Thing{capacity: st.Capacity}
+		if err := loadObject(&t.Object, st.savedObject); err != nil {
+			return nil, err
+		}
+		w.things[st.Key] = t
+	}
+
+	// Second pass: link everything together.
+
+	for _, sr := range saved.Rooms {
+		r := w.rooms[sr.Key]
+
+		if err := w.resolveOwner(&r.Object, sr.Owner); err != nil {
+			return nil, err
+		}
+
+		for _, key := range sr.Exits {
+			e, exists := w.exits[key]
+			if !exists {
+				return nil, fmt.Errorf("Room #%d has unknown exit #%d", sr.Key, key)
+			}
+			r.exits[key] = e
+		}
+	}
+
+	for _, se := range saved.Exits {
+		e := w.exits[se.Key]
+
+		if err := w.resolveOwner(&e.Object, se.Owner); err != nil {
+			return nil, err
+		}
+
+		if se.Destination != 0 {
+			d, exists := w.rooms[se.Destination]
+			if !exists {
+				return nil, fmt.Errorf("Exit #%d leads to unknown room #%d", se.Key, se.Destination)
+			}
+			e.destination = d
+		}
+	}
+
+	for _, sp := range saved.Players {
+		p := w.players[sp.Key]
+
+		if err := w.resolveOwner(&p.Object, sp.Owner); err != nil {
+			return nil, err
+		}
+
+		location, exists := w.rooms[sp.Location]
+		if !exists {
+			return nil, fmt.Errorf("Player #%d is in unknown room #%d", sp.Key, sp.Location)
+		}
+
+		p.location = location
+		location.players[p.key] = p
+	}
+
+	for _, st := range saved.Things {
+		t := w.things[st.Key]
+
+		if err := w.resolveOwner(&t.Object, st.Owner); err != nil {
+			return nil, err
+		}
+
+		location, exists := w.holder(st.Location)
+		if !exists {
+			return nil, fmt.Errorf("Thing #%d is in unknown holder #%d", st.Key, st.Location)
+		}
+
+		if err := w.moveThing(t, location); err != nil {
+			return nil, fmt.Errorf("Thing #%d: %s", st.Key, err)
+		}
+	}
+
+	w.freeKeys = saved.FreeKeys
+
+	lastKey := saved.LastKey
+	if k := w.lastKey(); k > lastKey {
+		lastKey = k
+	}
+	w.idGen = KeyGenFrom(lastKey)
+
+	return w, nil
+}
+
+func loadObject(o *Object, s savedObject) error {
+	lock, err := loadLock(s.Lock)
+
+	if err != nil {
+		return fmt.Errorf("Object #%d: %s", s.Key, err)
+	}
+
+	for _, a := range s.Attrs {
+		if !validAttrName(a.Name) {
+			return fmt.Errorf("Object #%d has bad attribute name '%s'", s.Key, a.Name)
+		}
+	}
+
+	o.key = s.Key
+	o.description = s.Description
+	o.flags = s.Flags
+	o.lock = lock
+	o.failMessage = s.Fail
+	o.SetName(s.Name)
+
+	for _, a := range s.Attrs {
+		o.SetAttribute(a.Name, a.Value)
+		o.SetAttributeFlags(a.Name, a.Flags)
+	}
+
+	return nil
+}
+
+// Saved locks are empty for unlocked objects.
+func loadLock(s string) (LockExpr, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	return ParseLock(s)
+}
+
+func (w *World) resolveOwner(o *Object, key int) error {
+	if key == 0 {
+		return nil
+	}
+
+	owner, exists := w.players[key]
+	if !exists {
+		return fmt.Errorf("Object #%d has unknown owner #%d", o.key, key)
+	}
+
+	o.owner = owner
+	return nil
+}
+
+//
+// The highest key in use by any object in the world.
+//
+func (w *World) lastKey() int {
+	last := 0
+
+	for key := range w.rooms {
+		if key > last {
+			last = key
+		}
+	}
+
+	for key := range w.exits {
+		if key > last {
+			last = key
+		}
+	}
+
+	for key := range w.players {
+		if key > last {
+			last = key
+		}
+	}
+
+	for key := range w.things {
+		if key > last {
+			last = key
+		}
+	}
+
+	for _, key := range w.freeKeys {
+		if key > last {
+			last = key
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func buildTestWorld() *World {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	jim, _ := world.NewPlayer("JiM", "bar", den)
+
+	bob.SetFlag(WizardFlag)
+	bob.SetFlag(BuilderFlag)
+	jim.SetDescription("Jim is short.")
+
+	hall.SetOwner(bob)
+	hall.SetDescription("It's a lovely hall")
+	den.SetOwner(jim)
+
+	east, _ := world.NewExit(hall, "east", den)
+	west, _ := world.NewExit(den, "west", hall)
+	east.SetOwner(bob)
+	west.SetOwner(jim)
+
+	return world
+}
+
+func reloadWorld(t *testing.T, world *World) *World {
+	var buf bytes.Buffer
+
+	if err := world.encode(&buf); err != nil {
+		t.Fatalf("Could not encode world: %s", err)
+	}
+
+	loaded, err := decodeWorld(&buf)
+
+	if err != nil {
+		t.Fatalf("Could not decode world: %s", err)
+	}
+
+	return loaded
+}
+
+func TestSaveAndLoadRestoresRooms(t *testing.T) {
+	loaded := reloadWorld(t, buildTestWorld())
+
+	if len(loaded.rooms) != 2 {
+		t.Fatalf("Expected 2 rooms, found %d", len(loaded.rooms))
+	}
+
+	hall := loaded.rooms[1]
+
+	if hall.Name() != "The Hall" || hall.NormalName() != "the hall" {
+		t.Errorf("Expected room #1 to be The Hall, was %s", hall.Name())
+	}
+
+	if hall.Description() != "It's a lovely hall" {
+		t.Errorf("Expected the hall's description to be restored")
+	}
+
+	if hall.Owner() != loaded.players[3] {
+		t.Errorf("Expected bob to own the hall")
+	}
+}
+
+func TestSaveAndLoadRestoresExits(t *testing.T) {
+	loaded := reloadWorld(t, buildTestWorld())
+	hall, den := loaded.rooms[1], loaded.rooms[2]
+
+	if len(loaded.exits) != 2 {
+		t.Fatalf("Expected 2 exits, found %d", len(loaded.exits))
+	}
+
+	east, exists := hall.exits[5]
+
+	if !exists || east.Name() != "east" {
+		t.Fatalf("Expected the hall to have an exit east")
+	}
+
+	if east.destination != den {
+		t.Errorf("Expected east to lead to the den")
+	}
+
+	if loaded.exits[6].destination != hall {
+		t.Errorf("Expected west to lead to the hall")
+	}
+}
+
+func TestSaveAndLoadRestoresPlayers(t *testing.T) {
+	loaded := reloadWorld(t, buildTestWorld())
+	bob, jim := loaded.players[3], loaded.players[4]
+
+	if bob == nil || jim == nil {
+		t.Fatalf("Expected bob and jim to be restored")
+	}
+
+	if !bob.IsSet(WizardFlag) || !bob.IsSet(BuilderFlag) {
+		t.Errorf("Expected bob's flags to be restored")
+	}
+
+	if jim.Name() != "JiM" || jim.NormalName() != "jim" {
+		t.Errorf("Expected jim's names to be restored")
+	}
+
+	if jim.location != loaded.rooms[2] {
+		t.Errorf("Expected jim to be in the den")
+	}
+
+	if _, here := loaded.rooms[2].players[jim.key]; !here {
+		t.Errorf("Expected the den to contain jim")
+	}
+
+	if bob.awake || bob.client != nil {
+		t.Errorf("Loaded players should be asleep")
+	}
+}
+
+func TestSaveAndLoadRestoresPasswords(t *testing.T) {
+	loaded := reloadWorld(t, buildTestWorld())
+	conn := NewMockConn()
+	client := NewClient(conn)
+
+	doConnect(loaded, client, Command{"connect", "", "jim bar"})
+
+	if client.player != loaded.players[4] {
+		t.Errorf("Expected jim to be able to connect after a reload")
+	}
+}
+
+func TestLoadResumesKeyGeneration(t *testing.T) {
+	loaded := reloadWorld(t, buildTestWorld())
+
+	attic, _ := loaded.NewRoom("The Attic")
+
+	if attic.key != 7 {
+		t.Errorf("Expected the next key to be 7, was %d", attic.key)
+	}
+}
+
+func TestLoadRejectsUnknownVersion(t *testing.T) {
+	_, err := decodeWorld(strings.NewReader(`{"version": 9999}`))
+
+	if err == nil {
+		t.Errorf("Expected an unknown version to be rejected")
+	}
+}
+
+func TestLoadRejectsDanglingReferences(t *testing.T) {
+	in := `{"version": 1, "rooms": [{"key": 1, "name": "The Hall", "exits": [2]}]}`
+
+	if _, err := decodeWorld(strings.NewReader(in)); err == nil {
+		t.Errorf("Expected a missing exit to be rejected")
+	}
+}
+
+func TestSaveWritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.json")
+
+	if err := buildTestWorld().Save(path); err != nil {
+		t.Fatalf("Could not save world: %s", err)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be renamed away")
+	}
+
+	loaded, err := LoadWorld(path)
+
+	if err != nil {
+		t.Fatalf("Could not load world: %s", err)
+	}
+
+	if len(loaded.rooms) != 2 || len(loaded.players) != 2 || len(loaded.exits) != 2 {
+		t.Errorf("Expected the saved world to be loaded in full")
+	}
+}
@@ -1,20 +1,47 @@
 package main
 
-import "crypto/sha512"
-
 //
 // A player interacts with the world
 //
 type Player struct {
 	Object
-	password [64]byte
+	// What the player is carrying
+	Contents
+	// Hashed, see password.go
+	password string
 	location *Room
 	awake    bool
 	client   *Client
+	// SSH public keys the player can log in with, in authorized_keys
+	// form without the comment, e.g. "ssh-ed25519 AAAA..."
+	publicKeys []string
+}
+
+func (p *Player) HasPublicKey(key string) bool {
+	for _, k := range p.publicKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (p *Player) SetPassword(raw string) {
-	p.password = sha512.Sum512([]byte(raw))
+func (p *Player) addPublicKey(key string) {
+	if !p.HasPublicKey(key) {
+		p.publicKeys = append(p.publicKeys, key)
+	}
+}
+
+func (p *Player) removePublicKey(key string) bool {
+	for i, k := range p.publicKeys {
+		if k == key {
+			p.publicKeys = append(p.publicKeys[:i:i], p.publicKeys[i+1:]...)
+			return true
+		}
+	}
+
+	return false
 }
 
 func (p *Player) CanSetFlag(target Objecter, flag Flags) bool {
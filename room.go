@@ -1,11 +1,114 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 //
-// Exits link two rooms together
+// Exits link two rooms together. An exit's name may be a list of
+// aliases separated by semicolons, e.g. "north;n;nor", any of which
+// can be used to take it. The first is the one shown to players.
 //
 type Exit struct {
 	Object
 	destination *Room
+	// Builders' messages for when the exit is taken, by kind.
+	messages map[string]string
+}
+
+//
+// The messages an exit can have. The success message is shown to the
+// player taking the exit, the leave message to the room they left,
+// and the arrive message to the room they arrive in. Each may use
+// "%n" for the player's name.
+//
+const (
+	SuccessMessage = "succ"
+	LeaveMessage   = "leave"
+	ArriveMessage  = "arrive"
+)
+
+func isExitMessage(kind string) bool {
+	return kind == SuccessMessage || kind == LeaveMessage || kind == ArriveMessage
+}
+
+// The message of the given kind as the builder set it.
+func (e *Exit) Message(kind string) string {
+	return e.messages[kind]
+}
+
+// Set a message, or clear it with an empty one.
+func (e *Exit) SetMessage(kind string, msg string) {
+	if msg == "" {
+		delete(e.messages, kind)
+		return
+	}
+
+	if e.messages == nil {
+		e.messages = make(map[string]string)
+	}
+
+	e.messages[kind] = msg
+}
+
+//
+// The message of the given kind to show when p takes the exit. Rooms
+// hear that players come and go even when the builder hasn't said
+// how; there's no default success message, as the player will see
+// where they are anyway.
+//
+func (e *Exit) messageFor(kind string, p *Player) string {
+	if msg := e.messages[kind]; msg != "" {
+		return substitute(msg, p)
+	}
+
+	switch kind {
+	case LeaveMessage:
+		return fmt.Sprintf("%s leaves %s.", p.name, e.DisplayName())
+	case ArriveMessage:
+		return fmt.Sprintf("%s arrives.", p.name)
+	}
+
+	return ""
+}
+
+// Every alias for the exit, normalized
+func (e *Exit) Aliases() []string {
+	var aliases []string
+
+	for _, alias := range strings.Split(e.normalName, ";") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases
+}
+
+// The name to show players
+func (e *Exit) DisplayName() string {
+	name := strings.TrimSpace(strings.SplitN(e.name, ";", 2)[0])
+
+	if name == "" {
+		return e.name
+	}
+
+	return name
+}
+
+// Can the exit be called this?
+func (e *Exit) Matches(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	for _, alias := range e.Aliases() {
+		if alias == name {
+			return true
+		}
+	}
+
+	return false
 }
 
 //
@@ -13,6 +116,48 @@ type Exit struct {
 //
 type Room struct {
 	Object
+	Contents
 	exits   map[int]*Exit
 	players map[int]*Player
 }
+
+// Tell everyone in the room something.
+func (r *Room) Tell(format string, args ...interface{}) {
+	for _, p := range r.players {
+		if p.client != nil {
+			p.client.Tell(format, args...)
+		}
+	}
+}
+
+// Find an exit from the room by any of its aliases.
+func (r *Room) FindExit(name string) *Exit {
+	for _, e := range r.exits {
+		if e.Matches(name) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+//
+// Could a new exit with this name be added to the room? No two exits
+// from a room may share any alias.
+//
+func (r *Room) CheckExitName(name string) error {
+	exit := &Exit{}
+	exit.SetName(name)
+
+	if len(exit.Aliases()) == 0 {
+		return errors.New("Exits must have a name.")
+	}
+
+	for _, alias := range exit.Aliases() {
+		if r.FindExit(alias) != nil {
+			return errors.New("An exit with that name already exists.")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExitAliases(t *testing.T) {
+	e := &Exit{}
+	e.SetName("North; N ;;nor")
+
+	if aliases := e.Aliases(); !reflect.DeepEqual(aliases, []string{"north", "n", "nor"}) {
+		t.Errorf("Unexpected aliases %q", aliases)
+	}
+
+	if e.DisplayName() != "North" {
+		t.Errorf("Expected the first alias to be shown, got %q", e.DisplayName())
+	}
+
+	if !e.Matches("N") || !e.Matches("nor") || e.Matches("no") {
+		t.Errorf("Expected the exit to match only its aliases")
+	}
+}
+
+func TestNewExitRefusesSharedAliases(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	world.NewExit(hall, "north;n", den)
+
+	if _, err := world.NewExit(hall, "n;up", den); err == nil {
+		t.Errorf("Expected an exit sharing an alias to be refused")
+	}
+
+	if _, err := world.NewExit(hall, " ; ", den); err == nil {
+		t.Errorf("Expected an exit without a name to be refused")
+	}
+
+	if _, err := world.NewExit(den, "south;n", hall); err != nil {
+		t.Errorf("Expected aliases to only need to differ within a room: %s", err)
+	}
+}
+
+func TestMoveByAnyAlias(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	north, _ := world.NewExit(hall, "north;n", den)
+	world.NewExit(den, "south;s", hall)
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	assertMatch(t, "exits:\r\n  north\r\n", conn.String())
+
+	if o, _ := world.FindTarget(client, Command{target: "N"}); o != north {
+		t.Errorf("Expected to find the exit by its alias")
+	}
+
+	cmd, _ := parseCommand(client, "n")
+	doMove(world, client, cmd)
+
+	if bob.location != den {
+		t.Fatalf("Expected bob to go north by the alias n")
+	}
+
+	doMove(world, client, Command{"move", "south", ""})
+
+	if bob.location != hall {
+		t.Errorf("Expected bob to go back south")
+	}
+}
+
+func TestDoDigRefusesSharedAliases(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	world.NewExit(hall, "north;n", den)
+	world.NewPlayer("bob", "foo", hall)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	client.player.SetFlag(BuilderFlag)
+
+	doDig(world, client, Command{"@dig", "up;n", "The Attic"})
+
+	if len(world.rooms) != 2 {
+		t.Errorf("Expected no room to be dug")
+	}
+
+	assertMatch(t, "An exit with that name already exists.\r\n", conn.String())
+}
+
+func newExitMessageTest() (*World, *Exit, *Client, *MockConn, *MockConn, *MockConn) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	den, _ := world.NewRoom("The Den")
+	north, _ := world.NewExit(hall, "north;n", den)
+	world.NewExit(den, "south;s", hall)
+	world.NewPlayer("bob", "foo", hall)
+	world.NewPlayer("jim", "bar", hall)
+	world.NewPlayer("sally", "baz", den)
+
+	bobConn, jimConn, sallyConn := NewMockConn(), NewMockConn(), NewMockConn()
+	bob := NewClient(bobConn)
+	doConnect(world, bob, Command{"connect", "", "bob foo"})
+	doConnect(world, NewClient(jimConn), Command{"connect", "", "jim bar"})
+	doConnect(world, NewClient(sallyConn), Command{"connect", "", "sally baz"})
+
+	return world, north, bob, bobConn, jimConn, sallyConn
+}
+
+func TestDoMoveTellsBothRooms(t *testing.T) {
+	world, _, bob, _, jimConn, sallyConn := newExitMessageTest()
+
+	doMove(world, bob, Command{"move", "n", ""})
+
+	assertMatch(t, "bob leaves north.\r\n", jimConn.String())
+	assertMatch(t, "bob arrives.\r\n", sallyConn.String())
+}
+
+func TestExitMessages(t *testing.T) {
+	world, north, bob, bobConn, jimConn, sallyConn := newExitMessageTest()
+	world.SetOwner(north, bob.player)
+
+	doSucc(world, bob, Command{"@succ", "north", "You squeeze through the gap."})
+	doLeave(world, bob, Command{"@leave", "north", "%n squeezes through a gap to the north."})
+	doArrive(world, bob, Command{"@arrive", "north", "%n squeezes in from the south."})
+	doExamine(world, bob, Command{"examine", "n", ""})
+
+	assertMatch(t, "Succ: You squeeze through the gap.\r\nLeave: %n squeezes", bobConn.String())
+
+	doMove(world, bob, Command{"move", "north", ""})
+
+	assertMatch(t, "You squeeze through the gap.\r\nThe Den", bobConn.String())
+	assertMatch(t, "bob squeezes through a gap to the north.\r\n", jimConn.String())
+	assertMatch(t, "bob squeezes in from the south.\r\n", sallyConn.String())
+
+	doSucc(world, bob, Command{"@succ", "south", "Whee!"})
+
+	assertMatch(t, "You can't do that.\r\n", bobConn.String())
+
+	doSucc(world, bob, Command{"@succ", "me", "Whee!"})
+
+	assertMatch(t, "bob isn't an exit.\r\n", bobConn.String())
+}
+
+func TestExitMessagesArePersistedAndJournaled(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "world.json")
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	north, _ := world.NewExit(hall, "north", hall)
+	world.SetExitMessage(north, LeaveMessage, "%n goes round in circles.")
+	world.Save(snapshot)
+
+	if loaded := reloadWorld(t, world); loaded.exits[north.key].Message(LeaveMessage) != "%n goes round in circles." {
+		t.Errorf("Expected the leave message to be restored")
+	}
+
+	path := openTestJournal(t, world)
+	world.SetExitMessage(north, LeaveMessage, "")
+	world.SetExitMessage(north, ArriveMessage, "%n is back.")
+
+	replayed, _ := LoadWorld(snapshot)
+
+	if _, err := ReplayJournal(replayed, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	x := replayed.exits[north.key]
+
+	if x.Message(LeaveMessage) != "" || x.Message(ArriveMessage) != "%n is back." {
+		t.Errorf("Expected the messages to be updated after replay")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//
+// Where the scheduler gets the time from. The server uses the system
+// clock; tests use a ManualClock so they can step time themselves.
+//
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+//
+// A clock that only moves when it's told to.
+//
+type ManualClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Identifies a timer, so it can be cancelled.
+type TimerID int
+
+//
+// Code to run at some point in the future. Repeating timers have an
+// interval, and are put back in the queue each time they run.
+//
+type timer struct {
+	id        TimerID
+	at        time.Time
+	interval  time.Duration
+	fn        func(w *World)
+	cancelled bool
+}
+
+//
+// Pending timers, soonest first. Timers due at the same moment run in
+// the order they were made.
+//
+type timerQueue []*timer
+
+func (q timerQueue) Len() int {
+	return len(q)
+}
+
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].id < q[j].id
+	}
+
+	return q[i].at.Before(q[j].at)
+}
+
+func (q timerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *timerQueue) Push(x interface{}) {
+	*q = append(*q, x.(*timer))
+}
+
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return t
+}
+
+func (w *World) SetClock(c Clock) {
+	w.clock = c
+}
+
+func (w *World) Now() time.Time {
+	if w.clock == nil {
+		w.clock = systemClock{}
+	}
+
+	return w.clock.Now()
+}
+
+func (w *World) schedule(at time.Time, interval time.Duration, fn func(w *World)) TimerID {
+	w.lastTimer++
+
+	t := &timer{id: w.lastTimer, at: at, interval: interval, fn: fn}
+
+	if w.timerIDs == nil {
+		w.timerIDs = make(map[TimerID]*timer)
+	}
+
+	w.timerIDs[t.id] = t
+	heap.Push(&w.timers, t)
+
+	return t.id
+}
+
+//
+// Run fn once, d from now, e.g. to reset a room in 30 seconds.
+//
+func (w *World) After(d time.Duration, fn func(w *World)) TimerID {
+	return w.schedule(w.Now().Add(d), 0, fn)
+}
+
+//
+// Run fn every d from now on, until the timer is cancelled. The world
+// only runs timers once a TICK, so d can't be any shorter. Runs that
+// are missed because the server was busy are skipped, not made up.
+//
+func (w *World) Every(d time.Duration, fn func(w *World)) (TimerID, error) {
+	if d < TICK {
+		return 0, fmt.Errorf("Repeating timers can't run more often than every %v.", TICK)
+	}
+
+	return w.schedule(w.Now().Add(d), d, fn), nil
+}
+
+//
+// Stop a timer from running again. Cancelling one that has already
+// finished, or never existed, does nothing.
+//
+func (w *World) Cancel(id TimerID) {
+	if t, exists := w.timerIDs[id]; exists {
+		t.cancelled = true
+		delete(w.timerIDs, id)
+	}
+}
+
+//
+// Run every timer that's due by now, in order. Timers made while this
+// is running wait for the next call, even if they're due already, so
+// one that keeps making another can't hold up the server. The world's
+// goroutine calls this every tick.
+//
+func (w *World) RunTimers() {
+	now := w.Now()
+	last := w.lastTimer
+
+	var later []*timer
+
+	for w.timers.Len() > 0 && !w.timers[0].at.After(now) {
+		t := heap.Pop(&w.timers).(*timer)
+
+		if t.cancelled {
+			continue
+		}
+
+		if t.id > last {
+			later = append(later, t)
+			continue
+		}
+
+		if t.interval > 0 {
+			t.at = t.at.Add(t.interval)
+
+			if !t.at.After(now) {
+				missed := now.Sub(t.at)/t.interval + 1
+				t.at = t.at.Add(missed * t.interval)
+			}
+
+			heap.Push(&w.timers, t)
+		} else {
+			delete(w.timerIDs, t.id)
+		}
+
+		t.fn(w)
+	}
+
+	for _, t := range later {
+		heap.Push(&w.timers, t)
+	}
+}
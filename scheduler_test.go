@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newSchedulerTest() (*World, *ManualClock) {
+	world := NewWorld()
+	clock := NewManualClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	world.SetClock(clock)
+
+	return world, clock
+}
+
+func TestAfterRunsOnce(t *testing.T) {
+	world, clock := newSchedulerTest()
+	runs := 0
+
+	world.After(30*time.Second, func(w *World) { runs++ })
+
+	clock.Advance(29 * time.Second)
+	world.RunTimers()
+
+	if runs != 0 {
+		t.Fatalf("Expected the timer not to run early")
+	}
+
+	clock.Advance(time.Second)
+	world.RunTimers()
+	clock.Advance(time.Minute)
+	world.RunTimers()
+
+	if runs != 1 {
+		t.Errorf("Expected the timer to run once, ran %d times", runs)
+	}
+}
+
+func TestEveryRepeatsUntilCancelled(t *testing.T) {
+	world, clock := newSchedulerTest()
+	runs := 0
+
+	id, err := world.Every(time.Second, func(w *World) { runs++ })
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Second)
+	world.RunTimers()
+	clock.Advance(time.Second)
+	world.RunTimers()
+
+	if runs != 2 {
+		t.Errorf("Expected 2 runs, got %d", runs)
+	}
+
+	// Missed runs are skipped, not made up all at once.
+	clock.Advance(time.Hour)
+	world.RunTimers()
+
+	if runs != 3 {
+		t.Errorf("Expected 3 runs, got %d", runs)
+	}
+
+	clock.Advance(time.Second)
+	world.RunTimers()
+
+	if runs != 4 {
+		t.Errorf("Expected the timer to keep its pace after a stall, got %d runs", runs)
+	}
+
+	world.Cancel(id)
+	clock.Advance(time.Second)
+	world.RunTimers()
+
+	if runs != 4 {
+		t.Errorf("Expected a cancelled timer not to run, got %d runs", runs)
+	}
+
+	if _, err := world.Every(0, func(w *World) {}); err == nil {
+		t.Errorf("Expected a timer with no interval to be refused")
+	}
+
+	if _, err := world.Every(time.Millisecond, func(w *World) {}); err == nil {
+		t.Errorf("Expected a timer more often than every tick to be refused")
+	}
+}
+
+func TestTimersRunInOrder(t *testing.T) {
+	world, clock := newSchedulerTest()
+	var order []string
+
+	world.After(2*time.Second, func(w *World) { order = append(order, "c") })
+	world.After(time.Second, func(w *World) { order = append(order, "a") })
+	world.After(time.Second, func(w *World) { order = append(order, "b") })
+
+	clock.Advance(2 * time.Second)
+	world.RunTimers()
+
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "c" {
+		t.Errorf("Unexpected order %q", order)
+	}
+}
+
+func TestTimersMadeByTimersWait(t *testing.T) {
+	world, clock := newSchedulerTest()
+	runs := 0
+
+	var again func(w *World)
+	again = func(w *World) {
+		runs++
+		w.After(0, again)
+	}
+
+	world.After(0, again)
+	world.RunTimers()
+	world.RunTimers()
+
+	if runs != 2 {
+		t.Errorf("Expected one run per call, got %d", runs)
+	}
+
+	// A timer can cancel another that's due at the same time.
+	var second TimerID
+
+	world.After(time.Second, func(w *World) { w.Cancel(second) })
+	second = world.After(time.Second, func(w *World) { t.Errorf("Expected the second timer to be cancelled") })
+
+	clock.Advance(time.Second)
+	world.RunTimers()
+}
+
+func TestTimersResetRooms(t *testing.T) {
+	world, clock := newSchedulerTest()
+	hall, _ := world.NewRoom("The Hall")
+	vase, _ := world.NewThing("Vase", hall)
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+
+	world.TakeThing(bob, vase)
+
+	world.After(30*time.Second, func(w *World) {
+		if vase.location != hall {
+			w.MoveThing(vase, hall)
+		}
+	})
+
+	clock.Advance(30 * time.Second)
+	world.RunTimers()
+
+	if vase.location != hall {
+		t.Errorf("Expected the vase to be put back in the hall")
+	}
+}
+
+func TestRunRunsTimersBetweenRequests(t *testing.T) {
+	world, clock := newSchedulerTest()
+	ran := make(chan bool, 1)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go world.Run(time.Millisecond, stop)
+
+	world.Do(func(w *World) {
+		w.After(time.Second, func(w *World) { ran <- true })
+	})
+
+	clock.Advance(time.Second)
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the world's goroutine to run the timer")
+	}
+}
@@ -0,0 +1,995 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// Softcode is a small Lisp-like language for giving objects
+// behavior. A program is stored in an attribute whose name starts
+// with "$", and runs as a verb: typing "pull lever" runs the lever's
+// $PULL attribute. For example:
+//
+//	&$pull lever=(do (tell me "Clunk.")
+//	                 (tell-others (str (name me) " pulls the lever.")))
+//
+// Programs can look at the world and talk to players, and can set
+// attributes on objects their owner controls, but nothing else.
+// Every program is stopped if it takes too many steps or too long.
+//
+
+//
+// Limits on every run of a program. Programs run on the world's
+// goroutine, so while one runs no other player's command can, and the
+// time limit is what one command can cost everyone else. Keep it low.
+//
+var (
+	scriptStepLimit   = 10000
+	scriptTimeLimit   = 5 * time.Millisecond
+	scriptDepthLimit  = 100
+	scriptStringLimit = 8192
+)
+
+type scriptSymbol string
+
+type scriptList []interface{}
+
+//
+// Parse a program into its expressions. Values in the tree are ints,
+// strings, symbols and lists.
+//
+func ParseScript(s string) (scriptList, error) {
+	p := &scriptParser{input: s}
+	var program scriptList
+
+	for {
+		p.skipSpace()
+
+		if p.pos == len(p.input) {
+			break
+		}
+
+		x, err := p.parse(0)
+
+		if err != nil {
+			return nil, err
+		}
+
+		program = append(program, x)
+	}
+
+	if len(program) == 0 {
+		return nil, errors.New("The program is empty.")
+	}
+
+	return program, nil
+}
+
+type scriptParser struct {
+	input string
+	pos   int
+}
+
+func (p *scriptParser) skipSpace() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *scriptParser) parse(depth int) (interface{}, error) {
+	if depth > scriptDepthLimit {
+		return nil, errors.New("The program is nested too deeply.")
+	}
+
+	p.skipSpace()
+
+	if p.pos == len(p.input) {
+		return nil, errors.New("The program ends too soon.")
+	}
+
+	switch p.input[p.pos] {
+	case '(':
+		p.pos++
+		list := scriptList{}
+
+		for {
+			p.skipSpace()
+
+			if p.pos == len(p.input) {
+				return nil, errors.New("Missing ')' in program.")
+			}
+
+			if p.input[p.pos] == ')' {
+				p.pos++
+				return list, nil
+			}
+
+			x, err := p.parse(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, x)
+		}
+
+	case ')':
+		return nil, errors.New("Unexpected ')' in program.")
+
+	case '"':
+		return p.parseString()
+	}
+
+	start := p.pos
+
+	for p.pos < len(p.input) && !strings.ContainsRune(" \t\r\n()\"", rune(p.input[p.pos])) {
+		p.pos++
+	}
+
+	atom := p.input[start:p.pos]
+
+	if n, err := strconv.Atoi(atom); err == nil {
+		return n, nil
+	}
+
+	return scriptSymbol(strings.ToLower(atom)), nil
+}
+
+func (p *scriptParser) parseString() (interface{}, error) {
+	var b strings.Builder
+
+	for p.pos++; p.pos < len(p.input); p.pos++ {
+		c := p.input[p.pos]
+
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.input):
+			p.pos++
+			if p.input[p.pos] == 'n' {
+				b.WriteString("\r\n")
+			} else {
+				b.WriteByte(p.input[p.pos])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return nil, errors.New("Missing '\"' in program.")
+}
+
+//
+// One run of a program. Programs run as the object's owner: they may
+// only see and change what the owner could.
+//
+type scriptMachine struct {
+	world    *World
+	actor    *Player
+	this     Objecter
+	steps    int
+	depth    int
+	deadline time.Time
+}
+
+type scriptEnv struct {
+	vars   map[string]interface{}
+	parent *scriptEnv
+}
+
+// Who the program runs as: the player it's on, or its object's owner.
+func (m *scriptMachine) runsAs() *Player {
+	if p, isPlayer := m.this.(*Player); isPlayer {
+		return p
+	}
+
+	return m.this.Owner()
+}
+
+func (env *scriptEnv) lookup(name string) (*scriptEnv, bool) {
+	for e := env; e != nil; e = e.parent {
+		if _, exists := e.vars[name]; exists {
+			return e, true
+		}
+	}
+
+	return nil, false
+}
+
+//
+// Run a program on behalf of a player, with "me" bound to the player,
+// "this" to the object the program is on, "here" to the player's
+// room and "args" to whatever they typed after the verb.
+//
+func (w *World) RunScript(program scriptList, actor *Player, this Objecter, args string) error {
+	m := &scriptMachine{
+		world:    w,
+		actor:    actor,
+		this:     this,
+		deadline: time.Now().Add(scriptTimeLimit),
+	}
+
+	env := &scriptEnv{vars: map[string]interface{}{
+		"me":   actor,
+		"this": this,
+		"here": actor.location,
+		"args": args,
+	}}
+
+	_, err := m.evalBody(program, env)
+	return err
+}
+
+func (m *scriptMachine) evalBody(body scriptList, env *scriptEnv) (result interface{}, err error) {
+	for _, x := range body {
+		if result, err = m.eval(x, env); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (m *scriptMachine) eval(x interface{}, env *scriptEnv) (interface{}, error) {
+	m.steps++
+
+	if m.steps > scriptStepLimit {
+		return nil, errors.New("The program took too many steps.")
+	}
+
+	if m.steps%64 == 0 && time.Now().After(m.deadline) {
+		return nil, errors.New("The program took too long.")
+	}
+
+	if m.depth >= scriptDepthLimit {
+		return nil, errors.New("The program went too deep.")
+	}
+
+	m.depth++
+	defer func() { m.depth-- }()
+
+	switch x := x.(type) {
+	case int, string:
+		return x, nil
+
+	case scriptSymbol:
+		switch x {
+		case "nil":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+
+		e, exists := env.lookup(string(x))
+
+		if !exists {
+			return nil, fmt.Errorf("'%s' isn't defined.", x)
+		}
+
+		return e.vars[string(x)], nil
+
+	case scriptList:
+		if len(x) == 0 {
+			return scriptList{}, nil
+		}
+
+		if name, isSymbol := x[0].(scriptSymbol); isSymbol {
+			if form, isForm := scriptForms[string(name)]; isForm {
+				return form(m, x[1:], env)
+			}
+
+			if fn, isBuiltin := scriptBuiltins[string(name)]; isBuiltin {
+				args := make(scriptList, len(x)-1)
+
+				for i, arg := range x[1:] {
+					var err error
+					if args[i], err = m.eval(arg, env); err != nil {
+						return nil, err
+					}
+				}
+
+				return fn(m, args)
+			}
+
+			return nil, fmt.Errorf("There's no function '%s'.", name)
+		}
+	}
+
+	return nil, errors.New("That can't be run.")
+}
+
+func scriptTruth(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case string:
+		return v != ""
+	case scriptList:
+		return len(v) > 0
+	}
+
+	return true
+}
+
+//
+// How a value looks when it's shown to a player. Lists can share
+// structure, so a short program can build one that would print
+// enormously; anything past the string limit is cut off.
+//
+func scriptString(v interface{}) string {
+	var b strings.Builder
+	writeScriptString(&b, v)
+	return b.String()
+}
+
+func writeScriptString(b *strings.Builder, v interface{}) {
+	if b.Len() > scriptStringLimit {
+		return
+	}
+
+	switch v := v.(type) {
+	case nil:
+	case string:
+		b.WriteString(v)
+	case Objecter:
+		b.WriteString(v.Name())
+	case scriptList:
+		for i, x := range v {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			writeScriptString(b, x)
+		}
+	default:
+		fmt.Fprint(b, v)
+	}
+}
+
+//
+// Special forms get their arguments unevaluated, and decide for
+// themselves what to run.
+//
+type scriptForm func(m *scriptMachine, args scriptList, env *scriptEnv) (interface{}, error)
+
+var scriptForms map[string]scriptForm
+
+// Builtins get their arguments evaluated.
+type scriptBuiltin func(m *scriptMachine, args scriptList) (interface{}, error)
+
+var scriptBuiltins map[string]scriptBuiltin
+
+// Set up in init, as the forms refer back to eval.
+func init() {
+	scriptForms = map[string]scriptForm{
+		"and":   formAnd,
+		"do":    formDo,
+		"if":    formIf,
+		"let":   formLet,
+		"or":    formOr,
+		"set!":  formSet,
+		"while": formWhile,
+	}
+
+	scriptBuiltins = map[string]scriptBuiltin{
+		"+":           arithmetic(func(a, b int) (int, error) { return a + b, nil }),
+		"-":           arithmetic(func(a, b int) (int, error) { return a - b, nil }),
+		"*":           arithmetic(func(a, b int) (int, error) { return a * b, nil }),
+		"/":           arithmetic(divide),
+		"mod":         arithmetic(modulo),
+		"<":           comparison(func(a, b int) bool { return a < b }),
+		">":           comparison(func(a, b int) bool { return a > b }),
+		"<=":          comparison(func(a, b int) bool { return a <= b }),
+		">=":          comparison(func(a, b int) bool { return a >= b }),
+		"=":           builtinEqual,
+		"not":         builtinNot,
+		"str":         builtinStr,
+		"list":        builtinList,
+		"len":         builtinLen,
+		"nth":         builtinNth,
+		"name":        builtinName,
+		"location":    builtinLocation,
+		"owner":       builtinOwner,
+		"contents":    builtinContents,
+		"find":        builtinFind,
+		"get-attr":    builtinGetAttr,
+		"set-attr":    builtinSetAttr,
+		"tell":        builtinTell,
+		"tell-others": builtinTellOthers,
+	}
+}
+
+func formDo(m *scriptMachine, args scriptList, env *scriptEnv) (interface{}, error) {
+	return m.evalBody(args, env)
+}
+
+// (if test then else)
+func formIf(m *scriptMachine, args scriptList, env *scriptEnv) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, errors.New("Try: (if test then else)")
+	}
+
+	test, err := m.eval(args[0], env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if scriptTruth(test) {
+		return m.eval(args[1], env)
+	}
+
+	if len(args) == 3 {
+		return m.eval(args[2], env)
+	}
+
+	return nil, nil
+}
+
+func formAnd(m *scriptMachine, args scriptList, env *scriptEnv) (interface{}, error) {
+	var result interface{} = true
+
+	for _, arg := range args {
+		var err error
+		if result, err = m.eval(arg, env); err != nil || !scriptTruth(result) {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func formOr(m *scriptMachine, args scriptList, env *scriptEnv) (interface{}, error) {
+	for _, arg := range args {
+		result, err := m.eval(arg, env)
+		if err != nil || scriptTruth(result) {
+			return result, err
+		}
+	}
+
+	return false, nil
+}
+
+// (let ((name value) ...) body...)
+func formLet(m *scriptMachine, args scriptList, env *scriptEnv) (interface{}, error) {
+	bindings, isList := scriptList(nil), false
+
+	if len(args) > 0 {
+		bindings, isList = args[0].(scriptList)
+	}
+
+	if !isList {
+		return nil, errors.New("Try: (let ((name value) ...) body)")
+	}
+
+	inner := &scriptEnv{vars: make(map[string]interface{}), parent: env}
+
+	for _, b := range bindings {
+		binding, isList := b.(scriptList)
+
+		if !isList || len(binding) != 2 {
+			return nil, errors.New("Try: (let ((name value) ...) body)")
+		}
+
+		name, isSymbol := binding[0].(scriptSymbol)
+
+		if !isSymbol {
+			return nil, errors.New("Only names can be bound by let.")
+		}
+
+		value, err := m.eval(binding[1], env)
+
+		if err != nil {
+			return nil, err
+		}
+
+		inner.vars[string(name)] = value
+	}
+
+	return m.evalBody(args[1:], inner)
+}
+
+// (set! name value)
+func formSet(m *scriptMachine, args scriptList, env *scriptEnv) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Try: (set! name value)")
+	}
+
+	name, isSymbol := args[0].(scriptSymbol)
+
+	if !isSymbol {
+		return nil, errors.New("Only names can be set.")
+	}
+
+	e, exists := env.lookup(string(name))
+
+	if !exists {
+		return nil, fmt.Errorf("'%s' isn't defined.", name)
+	}
+
+	value, err := m.eval(args[1], env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.vars[string(name)] = value
+	return value, nil
+}
+
+// (while test body...)
+func formWhile(m *scriptMachine, args scriptList, env *scriptEnv) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("Try: (while test body)")
+	}
+
+	for {
+		test, err := m.eval(args[0], env)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !scriptTruth(test) {
+			return nil, nil
+		}
+
+		if _, err = m.evalBody(args[1:], env); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func divide(a, b int) (int, error) {
+	if b == 0 {
+		return 0, errors.New("Division by zero.")
+	}
+
+	return a / b, nil
+}
+
+func modulo(a, b int) (int, error) {
+	if b == 0 {
+		return 0, errors.New("Division by zero.")
+	}
+
+	return a % b, nil
+}
+
+func arithmetic(op func(a, b int) (int, error)) scriptBuiltin {
+	return func(m *scriptMachine, args scriptList) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, errors.New("Arithmetic needs numbers.")
+		}
+
+		for _, arg := range args {
+			if _, isInt := arg.(int); !isInt {
+				return nil, fmt.Errorf("'%s' isn't a number.", scriptString(arg))
+			}
+		}
+
+		result := args[0].(int)
+
+		for _, arg := range args[1:] {
+			var err error
+			if result, err = op(result, arg.(int)); err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	}
+}
+
+func comparison(op func(a, b int) bool) scriptBuiltin {
+	return func(m *scriptMachine, args scriptList) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errors.New("Comparisons need two numbers.")
+		}
+
+		a, isInt := args[0].(int)
+		b, isIntToo := args[1].(int)
+
+		if !isInt || !isIntToo {
+			return nil, errors.New("Comparisons need two numbers.")
+		}
+
+		return op(a, b), nil
+	}
+}
+
+func builtinEqual(m *scriptMachine, args scriptList) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Try: (= a b)")
+	}
+
+	// Lists can't be compared with ==, and are never equal.
+	if _, isList := args[0].(scriptList); isList {
+		return false, nil
+	}
+
+	if _, isList := args[1].(scriptList); isList {
+		return false, nil
+	}
+
+	return args[0] == args[1], nil
+}
+
+func builtinNot(m *scriptMachine, args scriptList) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Try: (not x)")
+	}
+
+	return !scriptTruth(args[0]), nil
+}
+
+func builtinStr(m *scriptMachine, args scriptList) (interface{}, error) {
+	var b strings.Builder
+
+	for _, arg := range args {
+		writeScriptString(&b, arg)
+	}
+
+	if b.Len() > scriptStringLimit {
+		return nil, errors.New("The string got too long.")
+	}
+
+	return b.String(), nil
+}
+
+func builtinList(m *scriptMachine, args scriptList) (interface{}, error) {
+	return args, nil
+}
+
+func builtinLen(m *scriptMachine, args scriptList) (interface{}, error) {
+	if len(args) == 1 {
+		switch v := args[0].(type) {
+		case scriptList:
+			return len(v), nil
+		case string:
+			return len(v), nil
+		}
+	}
+
+	return nil, errors.New("Try: (len list)")
+}
+
+func builtinNth(m *scriptMachine, args scriptList) (interface{}, error) {
+	if len(args) == 2 {
+		list, isList := args[0].(scriptList)
+		n, isInt := args[1].(int)
+
+		if isList && isInt {
+			if n < 0 || n >= len(list) {
+				return nil, nil
+			}
+
+			return list[n], nil
+		}
+	}
+
+	return nil, errors.New("Try: (nth list n)")
+}
+
+func scriptObject(args scriptList, usage string) (Objecter, error) {
+	if len(args) == 1 {
+		if o, isObject := args[0].(Objecter); isObject {
+			return o, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Try: %s", usage)
+}
+
+func builtinName(m *scriptMachine, args scriptList) (interface{}, error) {
+	o, err := scriptObject(args, "(name object)")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return o.Name(), nil
+}
+
+func builtinLocation(m *scriptMachine, args scriptList) (interface{}, error) {
+	o, err := scriptObject(args, "(location object)")
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := o.(type) {
+	case *Player:
+		return o.location, nil
+	case *Thing:
+		return o.location, nil
+	case *Exit:
+		if o.destination != nil {
+			return o.destination, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func builtinOwner(m *scriptMachine, args scriptList) (interface{}, error) {
+	o, err := scriptObject(args, "(owner object)")
+
+	if err != nil || o.Owner() == nil {
+		return nil, err
+	}
+
+	return o.Owner(), nil
+}
+
+// The things in or held by an object, and the players in a room.
+func builtinContents(m *scriptMachine, args scriptList) (interface{}, error) {
+	o, err := scriptObject(args, "(contents object)")
+
+	if err != nil {
+		return nil, err
+	}
+
+	contents := scriptList{}
+
+	if r, isRoom := o.(*Room); isRoom {
+		for _, p := range r.players {
+			contents = append(contents, p)
+		}
+	}
+
+	// Closed containers keep their secrets.
+	if t, isThing := o.(*Thing); isThing && !t.IsOpen() {
+		return contents, nil
+	}
+
+	if h, isHolder := o.(Holder); isHolder {
+		for _, t := range h.contents().Things() {
+			contents = append(contents, t)
+		}
+	}
+
+	return contents, nil
+}
+
+// (find name) looks for a player or thing where the actor is.
+func builtinFind(m *scriptMachine, args scriptList) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Try: (find name)")
+	}
+
+	name := scriptString(args[0])
+	here := m.actor.location
+	normalName := strings.ToLower(name)
+
+	for _, p := range here.players {
+		if p.normalName == normalName {
+			return p, nil
+		}
+	}
+
+	if t := m.actor.FindThing(name); t != nil {
+		return t, nil
+	}
+
+	if t := here.FindThing(name); t != nil {
+		return t, nil
+	}
+
+	return nil, nil
+}
+
+func scriptAttrArgs(args scriptList, n int, usage string) (Objecter, string, error) {
+	if len(args) == n {
+		o, isObject := args[0].(Objecter)
+		name, isString := args[1].(string)
+
+		if isObject && isString && validAttrName(name) {
+			return o, name, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("Try: %s", usage)
+}
+
+func builtinGetAttr(m *scriptMachine, args scriptList) (interface{}, error) {
+	o, name, err := scriptAttrArgs(args, 2, "(get-attr object \"name\")")
+
+	if err != nil {
+		return nil, err
+	}
+
+	a, exists := o.Attribute(name)
+
+	if !exists {
+		return nil, nil
+	}
+
+	visible := a.Flags&AttrVisible != 0 && a.Flags&AttrWizard == 0
+
+	if owner := m.runsAs(); owner != nil && canSeeAttr(owner, o, a) {
+		visible = true
+	}
+
+	if !visible {
+		return nil, nil
+	}
+
+	return a.Value, nil
+}
+
+func builtinSetAttr(m *scriptMachine, args scriptList) (interface{}, error) {
+	o, name, err := scriptAttrArgs(args, 3, "(set-attr object \"name\" value)")
+
+	if err != nil {
+		return nil, err
+	}
+
+	owner := m.runsAs()
+
+	if owner == nil || isProgramAttr(name) || !canSetAttr(owner, o, name) {
+		return nil, fmt.Errorf("Can't set %s on %s.", normalAttrName(name), o.Name())
+	}
+
+	value := scriptString(args[2])
+
+	if value == "" {
+		m.world.ClearAttribute(o, name)
+	} else {
+		m.world.SetAttribute(o, name, value)
+	}
+
+	return args[2], nil
+}
+
+// (tell player message...)
+func builtinTell(m *scriptMachine, args scriptList) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errors.New("Try: (tell player message)")
+	}
+
+	p, isPlayer := args[0].(*Player)
+
+	if !isPlayer {
+		return nil, errors.New("Only players can be told things.")
+	}
+
+	msg, err := builtinStr(m, args[1:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.client != nil {
+		p.client.Tell("%s", msg)
+	}
+
+	return nil, nil
+}
+
+// (tell-others message...) tells everyone in the room but the actor.
+func builtinTellOthers(m *scriptMachine, args scriptList) (interface{}, error) {
+	msg, err := builtinStr(m, args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.world.TellAllButMe(m.actor, "%s", msg)
+	return nil, nil
+}
+
+//
+// Run the verb a player typed, if something near them has it. Returns
+// false if nothing does.
+//
+func (w *World) runVerb(client *Client, cmd Command) bool {
+	o := findVerb(client.player, cmd.verb, cmd.args)
+
+	if o == nil {
+		return false
+	}
+
+	attr, _ := o.Attribute("$" + cmd.verb)
+	program, err := ParseScript(attr.Value)
+
+	if err == nil {
+		err = w.RunScript(program, client.player, o, cmd.args)
+	}
+
+	if err != nil {
+		client.Tell("%s on %s (#%d) failed: %s", attr.Name, o.Name(), o.Key(), err)
+	}
+
+	return true
+}
+
+// Verbs are programs in attributes named "$<verb>".
+func isVerbAttr(name string) bool {
+	return strings.HasPrefix(strings.TrimSpace(name), "$")
+}
+
+// Attributes that hold programs, which only programmers may write.
+func isProgramAttr(name string) bool {
+	return isVerbAttr(name) || isEventAttr(name)
+}
+
+//
+// Find the object whose verb a player means. "pull lever" means the
+// lever's $PULL; plain "pull" means the first $PULL on something the
+// player carries, something in the room, or the room itself.
+//
+func findVerb(p *Player, verb string, target string) Objecter {
+	attr := "$" + verb
+
+	if !validAttrName(attr) {
+		return nil
+	}
+
+	hasVerb := func(o Objecter) bool {
+		_, exists := o.Attribute(attr)
+		return exists
+	}
+
+	target = strings.ToLower(strings.TrimSpace(target))
+	here := p.location
+
+	switch target {
+	case "":
+		for _, t := range p.Things() {
+			if hasVerb(t) {
+				return t
+			}
+		}
+
+		for _, t := range here.Things() {
+			if hasVerb(t) {
+				return t
+			}
+		}
+
+		if hasVerb(here) {
+			return here
+		}
+
+		return nil
+
+	case "here":
+		if hasVerb(here) {
+			return here
+		}
+
+		return nil
+
+	case "me":
+		if hasVerb(p) {
+			return p
+		}
+
+		return nil
+	}
+
+	if t := p.FindThing(target); t != nil && hasVerb(t) {
+		return t
+	}
+
+	if t := here.FindThing(target); t != nil && hasVerb(t) {
+		return t
+	}
+
+	if e := here.FindExit(target); e != nil && hasVerb(e) {
+		return e
+	}
+
+	return nil
+}
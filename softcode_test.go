@@ -0,0 +1,227 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScriptRejectsGarbage(t *testing.T) {
+	bad := []string{"", "   ", "(tell me", "(tell me))", ")", "(str \"oops)", strings.Repeat("(", 200)}
+
+	for _, s := range bad {
+		if _, err := ParseScript(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+// Run a program as bob, and return what he was told.
+func runTestScript(t *testing.T, program string) (string, error) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	world.NewPlayer("bob", "foo", hall)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	conn.writeBuffer.Reset()
+
+	parsed, err := ParseScript(program)
+
+	if err != nil {
+		t.Fatalf("Could not parse %q: %s", program, err)
+	}
+
+	err = world.RunScript(parsed, client.player, hall, "some args")
+	return conn.String(), err
+}
+
+func TestRunScript(t *testing.T) {
+	cases := map[string]string{
+		`(tell me "Hello, " (name me) "!")`:                                                    "Hello, bob!",
+		`(tell me (+ 1 2 3) " " (- 10 4) " " (* 2 3) " " (/ 7 2))`:                             "6 6 6 3",
+		`(tell me (if (< 1 2) "yes" "no") (if (= "a" "b") "yes"))`:                             "yes",
+		`(let ((n 0) (s "")) (while (< n 3) (set! s (str s n)) (set! n (+ n 1))) (tell me s))`: "012",
+		`(tell me (and 1 "x") (or nil false 0 "y") (not ""))`:                                  "xytrue",
+		`(tell me (name here) ": " args)`:                                                      "The Hall: some args",
+		`(tell me (len (contents here)) (nth (list "a" "b") 1) (location me))`:                 "1bThe Hall",
+		`(tell me (find "BOB"))`:                                                               "bob",
+	}
+
+	for program, want := range cases {
+		out, err := runTestScript(t, program)
+
+		if err != nil {
+			t.Errorf("Could not run %q: %s", program, err)
+			continue
+		}
+
+		if out != want+"\r\n" {
+			t.Errorf("Expected %q to say %q, got %q", program, want, out)
+		}
+	}
+}
+
+func TestRunScriptErrors(t *testing.T) {
+	cases := map[string]string{
+		`(tell me nobody)`:   "'nobody' isn't defined.",
+		`(frobnicate)`:       "There's no function 'frobnicate'.",
+		`(+ 1 "two")`:        "'two' isn't a number.",
+		`(mod 1 0)`:          "Division by zero.",
+		`(tell "bob" "hi")`:  "Only players can be told things.",
+		`(set! undefined 1)`: "'undefined' isn't defined.",
+		`("not a function")`: "That can't be run.",
+		`(while true)`:       "The program took too many steps.",
+		`(let ((s "ab")) (while true (set! s (str s s))))`: "The string got too long.",
+	}
+
+	for program, want := range cases {
+		if _, err := runTestScript(t, program); err == nil || err.Error() != want {
+			t.Errorf("Expected %q to fail with %q, got %v", program, want, err)
+		}
+	}
+}
+
+func TestRunScriptTimeLimit(t *testing.T) {
+	steps, limit := scriptStepLimit, scriptTimeLimit
+	scriptStepLimit, scriptTimeLimit = 1<<30, time.Millisecond
+
+	defer func() { scriptStepLimit, scriptTimeLimit = steps, limit }()
+
+	if _, err := runTestScript(t, `(while true)`); err == nil || err.Error() != "The program took too long." {
+		t.Errorf("Expected a runaway program to be stopped, got %v", err)
+	}
+}
+
+func TestRunScriptDefaultTimeLimit(t *testing.T) {
+	steps := scriptStepLimit
+	scriptStepLimit = 1 << 30
+
+	defer func() { scriptStepLimit = steps }()
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	program, _ := ParseScript(`(while true)`)
+
+	start := time.Now()
+	err := world.RunScript(program, bob, hall, "")
+
+	if err == nil || err.Error() != "The program took too long." {
+		t.Fatalf("Expected an endless loop to be stopped by the time limit, got %v", err)
+	}
+
+	// Allow plenty of slack for slow machines and the race detector.
+	if elapsed := time.Since(start); elapsed > 50*scriptTimeLimit {
+		t.Errorf("Expected the loop to stop after about %s, took %s", scriptTimeLimit, elapsed)
+	}
+}
+
+func TestRunScriptBoundsSharedLists(t *testing.T) {
+	// Each step doubles the printed size of l without copying it.
+	program := `(let ((l (list "x")) (n 0))
+	              (while (< n 40) (set! l (list l l)) (set! n (+ n 1)))
+	              (tell me l))`
+
+	if _, err := runTestScript(t, program); err == nil {
+		t.Errorf("Expected printing a huge list to fail")
+	}
+}
+
+func newVerbTest() (*World, *Client, *MockConn, *MockConn, *Thing) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	world.NewPlayer("jim", "bar", hall)
+	lever, _ := world.NewThing("Lever", hall)
+	world.SetOwner(lever, bob)
+
+	bobConn, jimConn := NewMockConn(), NewMockConn()
+	client := NewClient(bobConn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	doConnect(world, NewClient(jimConn), Command{"connect", "", "jim bar"})
+
+	return world, client, bobConn, jimConn, lever
+}
+
+func runLine(world *World, client *Client, line string) {
+	command, err := parseCommand(client, line)
+
+	if err != nil {
+		client.Tell("Huh?")
+		return
+	}
+
+	world.handleCommand(&commandHandlers, client, command)
+}
+
+func TestOnlyProgrammersWriteVerbs(t *testing.T) {
+	world, client, conn, _, lever := newVerbTest()
+
+	runLine(world, client, `&$pull lever=(tell me "Clunk.")`)
+
+	if _, exists := lever.Attribute("$pull"); exists {
+		t.Fatalf("Expected bob not to be able to write a verb")
+	}
+
+	assertMatch(t, "Only programmers can write programs.\r\n", conn.String())
+
+	client.player.SetFlag(ProgrammerFlag)
+	runLine(world, client, `&$pull lever=(tell me "Clunk."`)
+
+	assertMatch(t, "Missing '\\)' in program.\r\n", conn.String())
+
+	runLine(world, client, `&$pull lever=(tell me "Clunk.")`)
+
+	if _, exists := lever.Attribute("$pull"); !exists {
+		t.Errorf("Expected a programmer to be able to write a verb")
+	}
+}
+
+func TestVerbsRunPrograms(t *testing.T) {
+	world, client, bobConn, jimConn, lever := newVerbTest()
+	world.SetAttribute(lever, "$pull", `
+		(let ((n (+ 1 (if (get-attr this "pulls") 1 0))))
+		  (set-attr this "pulls" n)
+		  (tell me "Clunk.")
+		  (tell-others (name me) " pulls " (name this) "."))`)
+
+	runLine(world, client, "pull lever")
+
+	assertMatch(t, "Clunk.\r\n", bobConn.String())
+	assertMatch(t, "bob pulls Lever.\r\n", jimConn.String())
+
+	if a, _ := lever.Attribute("pulls"); a.Value != "1" {
+		t.Errorf("Expected the lever to count its pulls, got %q", a.Value)
+	}
+
+	// With nothing named, anything nearby with the verb will do.
+	runLine(world, client, "PULL")
+
+	if strings.Count(bobConn.String(), "Clunk.") != 2 {
+		t.Errorf("Expected a plain 'pull' to pull the lever")
+	}
+
+	runLine(world, client, "push lever")
+
+	assertMatch(t, "Huh\\?\r\n", bobConn.String())
+
+	world.SetAttribute(lever, "$break", `(tell me (/ 1 0))`)
+	runLine(world, client, "break lever")
+
+	assertMatch(t, "\\$BREAK on Lever \\(#4\\) failed: Division by zero.\r\n", bobConn.String())
+}
+
+func TestVerbsCantWriteVerbs(t *testing.T) {
+	world, client, bobConn, _, lever := newVerbTest()
+	world.SetAttribute(lever, "$pull", `(set-attr this "$push" "(tell me 1)")`)
+
+	runLine(world, client, "pull lever")
+
+	if _, exists := lever.Attribute("$push"); exists {
+		t.Errorf("Expected a program not to be able to write a verb")
+	}
+
+	assertMatch(t, "Can't set \\$PUSH on Lever.\r\n", bobConn.String())
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+//
+// An SSH front door. Players whose SSH user name matches a player
+// can log in with one of that player's keys, or with its password.
+// Any other user name gets the usual welcome screen, and can use
+// connect or newplayer from there.
+//
+
+// Sent with a "pty-req" request (RFC 4254, section 6.2)
+type sshPtyRequest struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+// Sent with a "window-change" request (RFC 4254, section 6.7)
+type sshWindowChange struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+func listenSSH(port int, hostKeyFile string) error {
+	signer, err := loadHostKey(hostKeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	config := &ssh.ServerConfig{
+		NoClientAuth:         true,
+		NoClientAuthCallback: sshGuestAuth,
+		PublicKeyCallback:    sshPublicKeyAuth,
+		PasswordCallback:     sshPasswordAuth,
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			if err != nil {
+				errorLog.Println("Could not accept SSH connection:", err)
+				continue
+			}
+
+			go serveSSH(conn, config)
+		}
+	}()
+
+	return nil
+}
+
+//
+// Load the host key, making a new one if the file doesn't exist yet.
+//
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		block, err := ssh.MarshalPrivateKey(key, "mud host key")
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = writePEM(path, block.Type, block.Bytes, 0600); err != nil {
+			return nil, err
+		}
+
+		infoLog.Println("Wrote new SSH host key to", path)
+
+		return ssh.NewSignerFromKey(key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKey(data)
+}
+
+func sshPlayerPermissions(p *Player) *ssh.Permissions {
+	return &ssh.Permissions{Extensions: map[string]string{"player": strconv.Itoa(p.key)}}
+}
+
+//
+// Users who aren't players get in without authenticating, and log in
+// (or not) once they're connected. Players must prove who they are.
+//
+func sshGuestAuth(meta ssh.ConnMetadata) (*ssh.Permissions, error) {
+	var player *Player
+
+	world.Do(func(w *World) { player = w.FindPlayer(meta.User()) })
+
+	if player != nil {
+		return nil, errors.New("Player must authenticate")
+	}
+
+	return nil, nil
+}
+
+func sshPublicKeyAuth(meta ssh.ConnMetadata, key ssh.PublicKey) (perms *ssh.Permissions, err error) {
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+
+	world.Do(func(w *World) {
+		player := w.FindPlayer(meta.User())
+
+		if player == nil || !player.HasPublicKey(authorized) {
+			err = errors.New("Unknown key")
+			return
+		}
+
+		perms = sshPlayerPermissions(player)
+	})
+
+	return
+}
+
+//
+// Check the password on this goroutine rather than the world's, since
+// it's slow, and only go back to the world to store an upgraded hash.
+//
+func sshPasswordAuth(meta ssh.ConnMetadata, password []byte) (perms *ssh.Permissions, err error) {
+	var player *Player
+	var stored string
+
+	world.Do(func(w *World) {
+		player = w.FindPlayer(meta.User())
+
+		if player != nil {
+			stored = player.password
+		}
+	})
+
+	if player == nil {
+		return nil, errors.New("Incorrect password")
+	}
+
+	ok, upgraded := checkPassword(stored, string(password))
+
+	if !ok {
+		return nil, errors.New("Incorrect password")
+	}
+
+	world.Do(func(w *World) {
+		w.UpgradePassword(player, stored, upgraded)
+		perms = sshPlayerPermissions(player)
+	})
+
+	return
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	server, channels, requests, err := ssh.NewServerConn(conn, config)
+
+	if err != nil {
+		infoLog.Println("SSH handshake failed for", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	infoLog.Println("Accepted SSH connection from:", server.RemoteAddr(), "as", server.User())
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "Only sessions are supported")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+
+		if err != nil {
+			errorLog.Println("Could not accept SSH channel:", err)
+			continue
+		}
+
+		go serveSSHSession(server, channel, requests)
+	}
+}
+
+func serveSSHSession(server *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
+	conn := &sshConn{Channel: channel, server: server, echo: true}
+	client := NewPlainClient(conn)
+	client.secure = true
+
+	started := false
+
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			var pty sshPtyRequest
+
+			if ssh.Unmarshal(req.Payload, &pty) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+
+			// With a pty the client sends keystrokes as they're
+			// typed, and leaves echoing them to us.
+			conn.Lock()
+			conn.pty = true
+			conn.Unlock()
+
+			world.Do(func(w *World) { setSSHWindowSize(client, pty.Columns, pty.Rows) })
+			req.Reply(true, nil)
+
+		case "window-change":
+			var size sshWindowChange
+
+			if ssh.Unmarshal(req.Payload, &size) == nil {
+				world.Do(func(w *World) { setSSHWindowSize(client, size.Columns, size.Rows) })
+			}
+
+		case "shell":
+			if started {
+				req.Reply(false, nil)
+				continue
+			}
+
+			started = true
+			req.Reply(true, nil)
+
+			go sshShell(client, server.Permissions)
+
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func setSSHWindowSize(client *Client, columns uint32, rows uint32) {
+	if columns > 0 {
+		client.width = int(columns)
+	}
+
+	if rows > 0 {
+		client.height = int(rows)
+	}
+}
+
+func sshShell(client *Client, permissions *ssh.Permissions) {
+	client.startOutput()
+
+	if permissions != nil {
+		key, _ := strconv.Atoi(permissions.Extensions["player"])
+		refused := false
+
+		world.Do(func(w *World) {
+			if player, exists := w.players[key]; exists {
+				if player.client != nil {
+					client.Tell("Already connected!")
+					client.Close()
+					refused = true
+					return
+				}
+
+				w.connectPlayer(client, player)
+			}
+		})
+
+		if refused {
+			return
+		}
+	}
+
+	connectionLoop(client)
+}
+
+//
+// sshConn adapts an SSH session channel to net.Conn. When the client
+// has asked for a pty it sends raw keystrokes, so we echo them back.
+//
+type sshConn struct {
+	ssh.Channel
+	server *ssh.ServerConn
+
+	sync.Mutex
+	pty   bool
+	echo  bool
+	typed int
+}
+
+func (c *sshConn) Read(b []byte) (int, error) {
+	n, err := c.Channel.Read(b)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.pty && n > 0 {
+		c.echoInput(b[:n])
+	}
+
+	return n, err
+}
+
+// Echo keystrokes, keeping track of the line so far so that
+// backspace can't rub out the prompt. The caller must hold the lock.
+func (c *sshConn) echoInput(input []byte) {
+	var out []byte
+
+	for _, b := range input {
+		switch {
+		case b == '\r' || b == '\n':
+			c.typed = 0
+			if c.echo {
+				out = append(out, '\r', '\n')
+			}
+		case b == '\b' || b == 127:
+			if c.typed > 0 {
+				c.typed--
+				if c.echo {
+					out = append(out, '\b', ' ', '\b')
+				}
+			}
+		case b >= ' ' || b == '\t':
+			c.typed++
+			if c.echo {
+				out = append(out, b)
+			}
+		}
+	}
+
+	if len(out) > 0 {
+		c.Channel.Write(out)
+	}
+}
+
+func (c *sshConn) SetEcho(on bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.echo = on
+}
+
+func (c *sshConn) Close() error {
+	exitStatus := struct{ Status uint32 }{0}
+	c.Channel.SendRequest("exit-status", false, ssh.Marshal(&exitStatus))
+	return c.Channel.Close()
+}
+
+func (c *sshConn) LocalAddr() net.Addr {
+	return c.server.LocalAddr()
+}
+
+func (c *sshConn) RemoteAddr() net.Addr {
+	return c.server.RemoteAddr()
+}
+
+// Deadlines aren't supported on SSH channels
+func (c *sshConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *sshConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
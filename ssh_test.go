@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connection details for an auth callback. Only the user is asked for.
+type testConnMetadata struct {
+	ssh.ConnMetadata
+	user string
+}
+
+func (m testConnMetadata) User() string {
+	return m.user
+}
+
+func newTestSSHKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Could not generate key: %s", err)
+	}
+
+	key, err := ssh.NewPublicKey(pub)
+
+	if err != nil {
+		t.Fatalf("Could not convert key: %s", err)
+	}
+
+	return key
+}
+
+// Make a player in the global world, which the callbacks look in, with
+// a name no other run of the test has used.
+func newSSHTestPlayer(t *testing.T, key ssh.PublicKey) *Player {
+	runGlobalWorld()
+
+	var player *Player
+
+	world.Do(func(w *World) {
+		room, _ := w.NewRoom("SSH Lobby")
+		player, _ = w.NewPlayer(fmt.Sprintf("sshuser%d", room.key), "secret", room)
+		w.AddPublicKey(player, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+	})
+
+	return player
+}
+
+func TestSSHGuestAuth(t *testing.T) {
+	player := newSSHTestPlayer(t, newTestSSHKey(t))
+
+	if perms, err := sshGuestAuth(testConnMetadata{user: "nobody"}); perms != nil || err != nil {
+		t.Errorf("Expected a guest to get in, got %v (%v)", perms, err)
+	}
+
+	if _, err := sshGuestAuth(testConnMetadata{user: player.name}); err == nil {
+		t.Errorf("Expected a player to have to authenticate")
+	}
+}
+
+func TestSSHPublicKeyAuth(t *testing.T) {
+	key := newTestSSHKey(t)
+	player := newSSHTestPlayer(t, key)
+
+	perms, err := sshPublicKeyAuth(testConnMetadata{user: player.name}, key)
+
+	if err != nil || perms.Extensions["player"] != strconv.Itoa(player.key) {
+		t.Errorf("Expected the player's key to log them in, got %v (%v)", perms, err)
+	}
+
+	if _, err := sshPublicKeyAuth(testConnMetadata{user: player.name}, newTestSSHKey(t)); err == nil {
+		t.Errorf("Expected someone else's key to be refused")
+	}
+
+	if _, err := sshPublicKeyAuth(testConnMetadata{user: "nobody"}, key); err == nil {
+		t.Errorf("Expected an unknown user to be refused")
+	}
+}
+
+func TestSSHPasswordAuth(t *testing.T) {
+	player := newSSHTestPlayer(t, newTestSSHKey(t))
+
+	perms, err := sshPasswordAuth(testConnMetadata{user: player.name}, []byte("secret"))
+
+	if err != nil || perms.Extensions["player"] != strconv.Itoa(player.key) {
+		t.Errorf("Expected the password to log the player in, got %v (%v)", perms, err)
+	}
+
+	if _, err := sshPasswordAuth(testConnMetadata{user: player.name}, []byte("wrong")); err == nil {
+		t.Errorf("Expected a wrong password to be refused")
+	}
+
+	if _, err := sshPasswordAuth(testConnMetadata{user: "nobody"}, []byte("secret")); err == nil {
+		t.Errorf("Expected an unknown user to be refused")
+	}
+}
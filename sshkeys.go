@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+//
+// Players may register SSH public keys, so that they can log in over
+// SSH without typing a password. Keys are stored the way they appear
+// in an authorized_keys file, as "<type> <base64 blob>", without any
+// comment.
+//
+
+// Key types we're prepared to store
+var sshKeyTypes = map[string]bool{
+	"ssh-ed25519":                        true,
+	"ssh-rsa":                            true,
+	"ecdsa-sha2-nistp256":                true,
+	"ecdsa-sha2-nistp384":                true,
+	"ecdsa-sha2-nistp521":                true,
+	"sk-ssh-ed25519@openssh.com":         true,
+	"sk-ecdsa-sha2-nistp256@openssh.com": true,
+}
+
+//
+// Parse a line from an authorized_keys file, and return the key in
+// the form it's stored. Options before the key aren't supported.
+//
+func parsePublicKey(line string) (string, error) {
+	fields := strings.Fields(line)
+
+	if len(fields) < 2 {
+		return "", errors.New("Expected a key of the form '<type> <key> [comment]'")
+	}
+
+	keyType := fields[0]
+
+	if !sshKeyTypes[keyType] {
+		return "", errors.New("Unsupported key type '" + keyType + "'")
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+
+	if err != nil {
+		return "", errors.New("The key is not valid base64")
+	}
+
+	// The blob starts with the key type again, as a length-prefixed
+	// string. If it doesn't match, the line has been mangled.
+	if len(blob) < 4 {
+		return "", errors.New("The key is too short")
+	}
+
+	n := binary.BigEndian.Uint32(blob)
+
+	if uint64(len(blob)-4) < uint64(n) || string(blob[4:4+n]) != keyType {
+		return "", errors.New("The key does not match its type")
+	}
+
+	return keyType + " " + fields[1], nil
+}
+
+//
+// The SHA256 fingerprint of a stored key, as shown by ssh-keygen -l.
+//
+func keyFingerprint(key string) string {
+	fields := strings.Fields(key)
+
+	if len(fields) < 2 {
+		return "?"
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+
+	if err != nil {
+		return "?"
+	}
+
+	hash := sha256.Sum256(blob)
+
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKmT4j7vDkfsC0rpitS+mQ1YmdSpUtgeoHIRtrteAumO"
+const testFingerprint = "SHA256:A5dqRhcMqDjWWpa0+U6IA6dLYa34MY6EbpPGATYbBl4"
+
+func TestParsePublicKeyDropsComment(t *testing.T) {
+	key, err := parsePublicKey("  " + testKey + "  bob@home ")
+
+	if err != nil || key != testKey {
+		t.Errorf("Expected %q, got %q (%v)", testKey, key, err)
+	}
+}
+
+func TestParsePublicKeyRejectsBadKeys(t *testing.T) {
+	fields := strings.Fields(testKey)
+
+	bad := []string{
+		"",
+		fields[0],
+		"ssh-dss " + fields[1],
+		fields[0] + " not*base64",
+		fields[0] + " AAAA",
+		"ssh-rsa " + fields[1],
+	}
+
+	for _, line := range bad {
+		if _, err := parsePublicKey(line); err == nil {
+			t.Errorf("Expected %q to be rejected", line)
+		}
+	}
+}
+
+func TestKeyFingerprintMatchesSSHKeygen(t *testing.T) {
+	if fp := keyFingerprint(testKey); fp != testFingerprint {
+		t.Errorf("Expected %s, got %s", testFingerprint, fp)
+	}
+}
+
+func TestDoAddKeyAndDelKey(t *testing.T) {
+	conn := NewMockConn()
+	client := NewClient(conn)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	client.player = bob
+
+	doAddKey(world, client, Command{"@addkey", "", testKey + " bob@home"})
+
+	if !bob.HasPublicKey(testKey) {
+		t.Fatalf("Expected bob to have the key")
+	}
+
+	assertMatch(t, "Key added: "+regexp.QuoteMeta(testFingerprint), conn.String())
+
+	doAddKey(world, client, Command{"@addkey", "", testKey})
+
+	if len(bob.publicKeys) != 1 {
+		t.Errorf("Expected the key to be added only once")
+	}
+
+	doKeys(world, client, Command{"@keys", "", ""})
+
+	assertMatch(t, "  1. ssh-ed25519 "+regexp.QuoteMeta(testFingerprint), conn.String())
+
+	doDelKey(world, client, Command{"@delkey", "", "2"})
+
+	assertMatch(t, "Try: @delkey <number>", conn.String())
+
+	doDelKey(world, client, Command{"@delkey", "", "1"})
+
+	if bob.HasPublicKey(testKey) {
+		t.Errorf("Expected the key to be removed")
+	}
+}
+
+func TestPublicKeysArePersisted(t *testing.T) {
+	world := buildTestWorld()
+	world.AddPublicKey(world.players[3], testKey)
+
+	loaded := reloadWorld(t, world)
+
+	if !loaded.players[3].HasPublicKey(testKey) {
+		t.Errorf("Expected bob's key to be restored")
+	}
+}
+
+func TestPublicKeysAreJournaled(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "world.json")
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	world.AddPublicKey(bob, testKey)
+	world.Save(snapshot)
+
+	path := openTestJournal(t, world)
+
+	other := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGq8h1QO0Q2Jvb2J2J9pbnR5m5rSTt4n0b1Xq7tJX1bC"
+	world.AddPublicKey(bob, other)
+	world.RemovePublicKey(bob, testKey)
+
+	loaded, _ := LoadWorld(snapshot)
+
+	if _, err := ReplayJournal(loaded, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	keys := loaded.players[bob.key].publicKeys
+
+	if len(keys) != 1 || keys[0] != other {
+		t.Errorf("Expected only the new key after replay, got %q", keys)
+	}
+}
+
+type echoConn struct {
+	*MockConn
+	echo bool
+}
+
+func (c *echoConn) SetEcho(on bool) {
+	c.echo = on
+}
+
+func TestEchoOffReachesConnectionsThatEcho(t *testing.T) {
+	conn := &echoConn{MockConn: NewMockConn(), echo: true}
+	client := NewPlainClient(conn)
+
+	client.EchoOff()
+
+	if conn.echo {
+		t.Errorf("Expected echo to be turned off")
+	}
+
+	client.EchoOn()
+
+	if !conn.echo {
+		t.Errorf("Expected echo to be turned back on")
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+)
+
+//
+// Telnet commands (RFC 854)
+//
+const (
+	SE   byte = 240
+	NOP  byte = 241
+	DM   byte = 242
+	BRK  byte = 243
+	IP   byte = 244
+	AO   byte = 245
+	AYT  byte = 246
+	EC   byte = 247
+	EL   byte = 248
+	GA   byte = 249
+	SB   byte = 250
+	WILL byte = 251
+	WONT byte = 252
+	DO   byte = 253
+	DONT byte = 254
+	IAC  byte = 255
+)
+
+//
+// Telnet options we know how to speak
+//
+const (
+	ECHO  byte = 1
+	SGA   byte = 3
+	NAWS  byte = 31
+	MCCP2 byte = 86
+	GMCP  byte = 201
+)
+
+// The longest line we'll buffer. Anything past this is dropped.
+const MAX_LINE = 4096
+
+// States of the input parser
+type telnetState uint8
+
+const (
+	stateData telnetState = iota
+	stateIAC
+	stateWill
+	stateWont
+	stateDo
+	stateDont
+	stateSB
+	stateSBIAC
+)
+
+// The state of one side of an option, as in the "Q method" of
+// RFC 1143. Tracking requests we've made stops us from answering our
+// own acknowledgements and looping forever.
+type optionState uint8
+
+const (
+	optNo optionState = iota
+	optYes
+	optWantNo
+	optWantYes
+)
+
+//
+// Telnet sits between a Client and its connection. It strips IAC
+// sequences out of the input, answers option negotiation, and
+// buffers what's left into complete lines.
+//
+type Telnet struct {
+	conn io.ReadWriter
+	// Where output goes. Usually the connection, but a client can
+	// queue it up to be sent by another goroutine.
+	out io.Writer
+	// When MCCP2 is on, output goes through the compressor rather
+	// than straight to the connection. If the compressed stream
+	// breaks, nothing more can be sent.
+	compressor *zlib.Writer
+	broken     error
+	// The other end doesn't speak telnet at all (e.g. a WebSocket),
+	// so never send it any telnet commands.
+	plain bool
+
+	state telnetState
+	sbBuf []byte
+
+	line  []byte
+	lines []string
+	sawCR bool
+
+	// Options we're willing to enable on our side, and options we'll
+	// allow the other side to enable.
+	local  map[byte]bool
+	remote map[byte]bool
+
+	us  [256]optionState
+	him [256]optionState
+
+	// Handlers for subnegotiation data, by option
+	subnegotiation map[byte]func(data []byte)
+	// Handlers called when an option on our side turns on or off
+	optionChange map[byte]func(enabled bool)
+}
+
+func NewTelnet(conn io.ReadWriter) *Telnet {
+	return &Telnet{
+		conn:   conn,
+		out:    conn,
+		local:  map[byte]bool{ECHO: true, SGA: true, GMCP: true, MCCP2: true},
+		remote: map[byte]bool{NAWS: true},
+
+		subnegotiation: make(map[byte]func(data []byte)),
+		optionChange:   make(map[byte]func(enabled bool)),
+	}
+}
+
+//
+// Register a handler to be called when an option on our side is
+// turned on or off, whoever asked for it.
+//
+func (t *Telnet) OnOptionChange(opt byte, handler func(enabled bool)) {
+	t.optionChange[opt] = handler
+}
+
+func (t *Telnet) setUs(opt byte, state optionState) {
+	was := t.us[opt] == optYes
+	t.us[opt] = state
+
+	if handler, exists := t.optionChange[opt]; exists && was != (state == optYes) {
+		handler(state == optYes)
+	}
+}
+
+//
+// Register a handler for subnegotiation of an option. The handler
+// is passed the data between IAC SB <option> and IAC SE, with any
+// escaped IACs already unescaped.
+//
+func (t *Telnet) OnSubnegotiation(opt byte, handler func(data []byte)) {
+	t.subnegotiation[opt] = handler
+}
+
+//
+// Handle input that someone else read from the connection, and return
+// any lines it completes.
+//
+func (t *Telnet) Receive(data []byte) []string {
+	t.receive(data)
+
+	lines := t.lines
+	t.lines = nil
+
+	return lines
+}
+
+//
+// Write data to the other side, escaping any IAC bytes in it.
+//
+func (t *Telnet) Write(b []byte) (int, error) {
+	if bytes.IndexByte(b, IAC) < 0 {
+		return t.write(b)
+	}
+
+	escaped := bytes.Replace(b, []byte{IAC}, []byte{IAC, IAC}, -1)
+
+	if _, err := t.write(escaped); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+//
+// Send subnegotiation data for an option, escaping any IAC bytes.
+//
+func (t *Telnet) Subnegotiate(opt byte, data []byte) error {
+	if t.plain {
+		return nil
+	}
+
+	msg := []byte{IAC, SB, opt}
+	msg = append(msg, bytes.Replace(data, []byte{IAC}, []byte{IAC, IAC}, -1)...)
+	msg = append(msg, IAC, SE)
+
+	_, err := t.write(msg)
+	return err
+}
+
+// Send a raw command, with no escaping.
+func (t *Telnet) send(b ...byte) {
+	if !t.plain {
+		t.write(b)
+	}
+}
+
+func (t *Telnet) write(b []byte) (int, error) {
+	if t.broken != nil {
+		return 0, t.broken
+	}
+
+	if t.compressor == nil {
+		return t.out.Write(b)
+	}
+
+	n, err := t.compressor.Write(b)
+
+	if err == nil {
+		err = t.compressor.Flush()
+	}
+
+	// The client can't make sense of anything sent after a broken
+	// compressed stream, so give up on the connection. Closing it
+	// ends the client's connectionLoop.
+	if err != nil {
+		t.compressor = nil
+		t.broken = err
+
+		if c, ok := t.conn.(io.Closer); ok {
+			go c.Close()
+		}
+	}
+
+	return n, err
+}
+
+//
+// Ask to enable or disable an option on our side.
+//
+func (t *Telnet) Will(opt byte) {
+	if t.us[opt] == optNo && !t.plain {
+		t.us[opt] = optWantYes
+		t.send(IAC, WILL, opt)
+	}
+}
+
+func (t *Telnet) Wont(opt byte) {
+	if t.us[opt] == optYes || t.us[opt] == optWantYes {
+		t.setUs(opt, optWantNo)
+		t.send(IAC, WONT, opt)
+	}
+}
+
+//
+// Ask the other side to enable or disable an option.
+//
+func (t *Telnet) Do(opt byte) {
+	if t.him[opt] == optNo && !t.plain {
+		t.him[opt] = optWantYes
+		t.send(IAC, DO, opt)
+	}
+}
+
+func (t *Telnet) Dont(opt byte) {
+	if t.him[opt] == optYes || t.him[opt] == optWantYes {
+		t.him[opt] = optWantNo
+		t.send(IAC, DONT, opt)
+	}
+}
+
+// Is an option enabled on our side?
+func (t *Telnet) Enabled(opt byte) bool {
+	return t.us[opt] == optYes
+}
+
+// Has the other side enabled an option?
+func (t *Telnet) HimEnabled(opt byte) bool {
+	return t.him[opt] == optYes
+}
+
+func (t *Telnet) receive(data []byte) {
+	for _, b := range data {
+		switch t.state {
+		case stateData:
+			if b == IAC {
+				t.state = stateIAC
+			} else {
+				t.receiveData(b)
+			}
+
+		case stateIAC:
+			t.state = stateData
+
+			switch b {
+			case IAC:
+				t.receiveData(b)
+			case WILL:
+				t.state = stateWill
+			case WONT:
+				t.state = stateWont
+			case DO:
+				t.state = stateDo
+			case DONT:
+				t.state = stateDont
+			case SB:
+				t.state = stateSB
+				t.sbBuf = t.sbBuf[:0]
+			case EC:
+				t.eraseChar()
+			case EL:
+				t.line = t.line[:0]
+			}
+
+		case stateWill:
+			t.receiveWill(b)
+			t.state = stateData
+
+		case stateWont:
+			t.receiveWont(b)
+			t.state = stateData
+
+		case stateDo:
+			t.receiveDo(b)
+			t.state = stateData
+
+		case stateDont:
+			t.receiveDont(b)
+			t.state = stateData
+
+		case stateSB:
+			if b == IAC {
+				t.state = stateSBIAC
+			} else if len(t.sbBuf) < MAX_LINE {
+				t.sbBuf = append(t.sbBuf, b)
+			}
+
+		case stateSBIAC:
+			switch b {
+			case SE:
+				t.state = stateData
+				t.receiveSubnegotiation()
+			case IAC:
+				t.state = stateSB
+				if len(t.sbBuf) < MAX_LINE {
+					t.sbBuf = append(t.sbBuf, IAC)
+				}
+			default:
+				// Not valid inside a subnegotiation. Throw the
+				// whole thing away.
+				t.state = stateData
+			}
+		}
+	}
+}
+
+func (t *Telnet) receiveData(b byte) {
+	// Lines may end in CR LF, CR NUL, or a bare LF.
+	if t.sawCR {
+		t.sawCR = false
+		if b == '\n' || b == 0 {
+			return
+		}
+	}
+
+	switch {
+	case b == '\r':
+		t.sawCR = true
+		t.endLine()
+	case b == '\n':
+		t.endLine()
+	case b == '\b' || b == 127:
+		t.eraseChar()
+	case b < ' ' && b != '\t':
+		// Drop other control characters
+	case len(t.line) < MAX_LINE:
+		t.line = append(t.line, b)
+	}
+}
+
+func (t *Telnet) endLine() {
+	t.lines = append(t.lines, string(t.line))
+	t.line = t.line[:0]
+}
+
+func (t *Telnet) eraseChar() {
+	if len(t.line) > 0 {
+		t.line = t.line[:len(t.line)-1]
+	}
+}
+
+func (t *Telnet) receiveWill(opt byte) {
+	switch t.him[opt] {
+	case optNo:
+		if t.remote[opt] {
+			t.him[opt] = optYes
+			t.send(IAC, DO, opt)
+		} else {
+			t.send(IAC, DONT, opt)
+		}
+	case optWantYes:
+		t.him[opt] = optYes
+	case optWantNo:
+		t.him[opt] = optNo
+	}
+}
+
+func (t *Telnet) receiveWont(opt byte) {
+	switch t.him[opt] {
+	case optYes:
+		t.him[opt] = optNo
+		t.send(IAC, DONT, opt)
+	case optWantYes, optWantNo:
+		t.him[opt] = optNo
+	}
+}
+
+func (t *Telnet) receiveDo(opt byte) {
+	switch t.us[opt] {
+	case optNo:
+		if t.local[opt] {
+			t.send(IAC, WILL, opt)
+			t.setUs(opt, optYes)
+		} else {
+			t.send(IAC, WONT, opt)
+		}
+	case optWantYes:
+		t.setUs(opt, optYes)
+	case optWantNo:
+		t.setUs(opt, optNo)
+	}
+}
+
+func (t *Telnet) receiveDont(opt byte) {
+	switch t.us[opt] {
+	case optYes:
+		t.setUs(opt, optNo)
+		t.send(IAC, WONT, opt)
+	case optWantYes, optWantNo:
+		t.setUs(opt, optNo)
+	}
+}
+
+func (t *Telnet) receiveSubnegotiation() {
+	if len(t.sbBuf) == 0 {
+		return
+	}
+
+	if handler, exists := t.subnegotiation[t.sbBuf[0]]; exists {
+		handler(t.sbBuf[1:])
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestTelnet(reads ...string) (*Telnet, *MockConn) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+
+	for _, r := range reads {
+		conn.readBytes = append(conn.readBytes, []byte(r))
+	}
+
+	return NewTelnet(conn), conn
+}
+
+// Feed everything there is to read through Receive, as connectionLoop
+// does, and return the lines it completes.
+func readAllLines(t *Telnet) []string {
+	var lines []string
+	buf := make([]byte, 1024)
+
+	for {
+		n, err := t.conn.Read(buf)
+		lines = append(lines, t.Receive(buf[:n])...)
+
+		if err != nil {
+			return lines
+		}
+	}
+}
+
+func assertLines(t *testing.T, expected []string, actual []string) {
+	if len(expected) != len(actual) {
+		t.Fatalf("Expected lines %q, got %q", expected, actual)
+	}
+
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("Expected lines %q, got %q", expected, actual)
+			return
+		}
+	}
+}
+
+func TestTelnetSplitsLines(t *testing.T) {
+	telnet, _ := newTestTelnet("look\r\nsay hi\nwest\r\x00east\r\n")
+
+	assertLines(t, []string{"look", "say hi", "west", "east"}, readAllLines(telnet))
+}
+
+func TestTelnetJoinsLinesAcrossReads(t *testing.T) {
+	telnet, _ := newTestTelnet("sa", "y hel", "lo\r", "\nlook\r\n")
+
+	assertLines(t, []string{"say hello", "look"}, readAllLines(telnet))
+}
+
+func TestTelnetReceiveReturnsCompleteLines(t *testing.T) {
+	telnet, conn := newTestTelnet()
+
+	assertLines(t, []string{"look"}, telnet.Receive([]byte("look\r\nsa")))
+	assertLines(t, []string{}, telnet.Receive([]byte{IAC, DO, ECHO}))
+	assertLines(t, []string{"say hi"}, telnet.Receive([]byte("y hi\r\n")))
+
+	if !bytes.Equal(conn.writeBuffer.Bytes(), []byte{IAC, WILL, ECHO}) {
+		t.Errorf("Expected option negotiation to be answered, got %v", conn.writeBuffer.Bytes())
+	}
+}
+
+func TestTelnetDropsPartialLineAtEOF(t *testing.T) {
+	telnet, _ := newTestTelnet("look\r\nwes")
+
+	assertLines(t, []string{"look"}, readAllLines(telnet))
+}
+
+func TestTelnetStripsCommands(t *testing.T) {
+	telnet, _ := newTestTelnet("lo\xff\xf1ok\r\n", "\xff\xfa\x18\x00xterm\xff\xf0say hi\r\n")
+
+	assertLines(t, []string{"look", "say hi"}, readAllLines(telnet))
+}
+
+func TestTelnetHandlesEscapedIAC(t *testing.T) {
+	telnet, _ := newTestTelnet("a\xff\xffb\r\n")
+
+	assertLines(t, []string{"a\xffb"}, readAllLines(telnet))
+}
+
+func TestTelnetHandlesErasure(t *testing.T) {
+	telnet, _ := newTestTelnet("lookk\b\r\n", "garbage\xff\xf8look\r\n")
+
+	assertLines(t, []string{"look", "look"}, readAllLines(telnet))
+}
+
+func TestTelnetRefusesUnknownOptions(t *testing.T) {
+	telnet, conn := newTestTelnet("\xff\xfb\x18\xff\xfd\x18look\r\n")
+
+	assertLines(t, []string{"look"}, readAllLines(telnet))
+
+	expected := []byte{IAC, DONT, 0x18, IAC, WONT, 0x18}
+
+	if !bytes.Equal(conn.writeBuffer.Bytes(), expected) {
+		t.Errorf("Expected %v, got %v", expected, conn.writeBuffer.Bytes())
+	}
+}
+
+func TestTelnetAgreesToSupportedOptions(t *testing.T) {
+	telnet, conn := newTestTelnet("\xff\xfd\x03\xff\xfd\x03\r\n")
+
+	readAllLines(telnet)
+
+	// Only the first request is answered, the second is a no-op.
+	expected := []byte{IAC, WILL, SGA}
+
+	if !bytes.Equal(conn.writeBuffer.Bytes(), expected) {
+		t.Errorf("Expected %v, got %v", expected, conn.writeBuffer.Bytes())
+	}
+
+	if !telnet.Enabled(SGA) {
+		t.Errorf("Expected SGA to be enabled")
+	}
+}
+
+func TestTelnetDoesNotAnswerAcknowledgements(t *testing.T) {
+	telnet, conn := newTestTelnet("\xff\xfd\x01\r\n")
+
+	telnet.Will(ECHO)
+	readAllLines(telnet)
+
+	expected := []byte{IAC, WILL, ECHO}
+
+	if !bytes.Equal(conn.writeBuffer.Bytes(), expected) {
+		t.Errorf("Expected %v, got %v", expected, conn.writeBuffer.Bytes())
+	}
+
+	if !telnet.Enabled(ECHO) {
+		t.Errorf("Expected ECHO to be enabled")
+	}
+}
+
+func TestTelnetEscapesOutput(t *testing.T) {
+	telnet, conn := newTestTelnet()
+
+	n, err := telnet.Write([]byte("a\xffb"))
+
+	if n != 3 || err != nil {
+		t.Errorf("Expected to write 3 bytes, wrote %d", n)
+	}
+
+	if conn.String() != "a\xff\xffb" {
+		t.Errorf("Expected IAC to be escaped, got %q", conn.String())
+	}
+}
+
+func TestClientEchoOffAndOn(t *testing.T) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+	client := NewClient(conn)
+
+	client.EchoOff()
+	client.EchoOn()
+
+	expected := []byte{IAC, WILL, ECHO, IAC, WONT, ECHO}
+
+	if !bytes.Equal(conn.writeBuffer.Bytes(), expected) {
+		t.Errorf("Expected %v, got %v", expected, conn.writeBuffer.Bytes())
+	}
+}
+
+func TestTelnetPassesSubnegotiationToHandler(t *testing.T) {
+	telnet, _ := newTestTelnet("\xff\xfa\x1f\x00\xff\xff\x00\x18\xff\xf0look\r\n")
+
+	var received []byte
+	telnet.OnSubnegotiation(NAWS, func(data []byte) {
+		received = append([]byte{}, data...)
+	})
+
+	assertLines(t, []string{"look"}, readAllLines(telnet))
+
+	if !bytes.Equal(received, []byte{0, 255, 0, 24}) {
+		t.Errorf("Expected unescaped NAWS data, got %v", received)
+	}
+}
+
+func TestTelnetLimitsSubnegotiationLength(t *testing.T) {
+	telnet, _ := newTestTelnet()
+
+	telnet.Receive([]byte{IAC, SB, NAWS})
+	telnet.Receive(bytes.Repeat([]byte{IAC, IAC}, 2*MAX_LINE))
+
+	if len(telnet.sbBuf) > MAX_LINE {
+		t.Errorf("Expected at most %d bytes of subnegotiation, got %d", MAX_LINE, len(telnet.sbBuf))
+	}
+}
+
+func TestClientNegotiatesWindowSize(t *testing.T) {
+	conn := NewMockConn()
+	conn.writeBuffer.Reset()
+	conn.readBytes = append(conn.readBytes, []byte("\xff\xfb\x1f\xff\xfa\x1f\x00\x28\x00\x10\xff\xf0\r\n"))
+	client := NewClient(conn)
+
+	client.negotiate()
+	readAllLines(client.telnet)
+
+	if !bytes.HasPrefix(conn.writeBuffer.Bytes(), []byte{IAC, DO, NAWS}) {
+		t.Errorf("Expected to ask for NAWS, got %v", conn.writeBuffer.Bytes())
+	}
+
+	if client.width != 40 || client.height != 16 {
+		t.Errorf("Expected a 40x16 screen, got %dx%d", client.width, client.height)
+	}
+}
+
+func TestClientKeepsSizeWhenUnknown(t *testing.T) {
+	client := NewClient(NewMockConn())
+
+	client.receiveWindowSize([]byte{0, 0, 0, 0})
+
+	if client.width != DEFAULT_WIDTH || client.height != DEFAULT_HEIGHT {
+		t.Errorf("Expected the default screen size, got %dx%d", client.width, client.height)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+//
+// A thing is an object that can be picked up and carried around.
+// It's always somewhere: in a room, held by a player, or inside
+// another thing.
+//
+// Things with the container flag can hold other things, when they're
+// open, up to their capacity. A capacity of zero means no limit.
+//
+type Thing struct {
+	Object
+	Contents
+	location Holder
+	capacity int
+}
+
+//
+// The things an object is holding. Embedding Contents in an object
+// makes it a Holder.
+//
+type Contents struct {
+	things map[int]*Thing
+}
+
+//
+// Anything that can hold things.
+//
+type Holder interface {
+	Objecter
+	contents() *Contents
+}
+
+func (c *Contents) contents() *Contents {
+	return c
+}
+
+func (c *Contents) add(t *Thing) {
+	if c.things == nil {
+		c.things = make(map[int]*Thing)
+	}
+
+	c.things[t.key] = t
+}
+
+func (c *Contents) remove(t *Thing) {
+	delete(c.things, t.key)
+}
+
+// The things held, in the order they were created.
+func (c *Contents) Things() []*Thing {
+	things := make([]*Thing, 0, len(c.things))
+
+	for _, t := range c.things {
+		things = append(things, t)
+	}
+
+	sort.Slice(things, func(i, j int) bool { return things[i].key < things[j].key })
+
+	return things
+}
+
+// Find a held thing by name, ignoring case.
+func (c *Contents) FindThing(name string) *Thing {
+	normalName := strings.ToLower(name)
+
+	for _, t := range c.Things() {
+		if t.normalName == normalName {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func (t *Thing) Location() Holder {
+	return t.location
+}
+
+func (t *Thing) IsContainer() bool {
+	return t.IsSet(ContainerFlag)
+}
+
+func (t *Thing) IsOpen() bool {
+	return !t.IsSet(ClosedFlag)
+}
+
+func (t *Thing) Capacity() int {
+	return t.capacity
+}
+
+// Is the thing full to capacity?
+func (t *Thing) Full() bool {
+	return t.capacity > 0 && len(t.things) >= t.capacity
+}
+
+//
+// Is h this thing, or somewhere inside it however deeply? Only things
+// can be inside things, so following locations up from h finds t if
+// it's there.
+//
+func (t *Thing) Encloses(h Holder) bool {
+	for h != nil {
+		if h == Holder(t) {
+			return true
+		}
+
+		inner, isThing := h.(*Thing)
+
+		if !isThing {
+			return false
+		}
+
+		h = inner.location
+	}
+
+	return false
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewThingIsHeld(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	lamp, _ := world.NewThing("Brass Lamp", hall)
+
+	if lamp.Location() != hall || hall.FindThing("brass lamp") != lamp {
+		t.Errorf("Expected the lamp to be in the hall")
+	}
+
+	if o, exists := world.object(lamp.key); !exists || o != lamp {
+		t.Errorf("Expected the lamp to be found by key")
+	}
+
+	if _, err := world.NewThing("  ", hall); err == nil {
+		t.Errorf("Expected things without names to be refused")
+	}
+}
+
+func TestGetDropAndInventory(t *testing.T) {
+	conn := NewMockConn()
+	client := NewClient(conn)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	lamp, _ := world.NewThing("Lamp", hall)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	assertMatch(t, "You see:\r\n  Lamp\r\n", conn.String())
+
+	doGet(world, client, Command{"get", "lamp", ""})
+
+	if lamp.Location() != bob || hall.FindThing("lamp") != nil {
+		t.Fatalf("Expected bob to be holding the lamp")
+	}
+
+	assertMatch(t, "Taken.\r\n", conn.String())
+
+	doInventory(world, client, Command{"inventory", "", ""})
+
+	assertMatch(t, "You are carrying:\r\n  Lamp\r\n", conn.String())
+
+	doGet(world, client, Command{"get", "lamp", ""})
+
+	assertMatch(t, "I don't see that here.\r\n", conn.String())
+
+	doDrop(world, client, Command{"drop", "lamp", ""})
+
+	if lamp.Location() != hall {
+		t.Errorf("Expected the lamp to be back in the hall")
+	}
+
+	doInventory(world, client, Command{"inventory", "", ""})
+
+	assertMatch(t, "You aren't carrying anything.\r\n", conn.String())
+}
+
+func TestGiveMovesThingToAnotherPlayer(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	jim, _ := world.NewPlayer("jim", "bar", hall)
+	lamp, _ := world.NewThing("Lamp", bob)
+
+	bobConn, jimConn := NewMockConn(), NewMockConn()
+	bobClient, jimClient := NewClient(bobConn), NewClient(jimConn)
+	doConnect(world, bobClient, Command{"connect", "", "bob foo"})
+	doConnect(world, jimClient, Command{"connect", "", "jim bar"})
+
+	doGive(world, bobClient, Command{"give", "jim", "lamp"})
+
+	if lamp.Location() != jim {
+		t.Fatalf("Expected jim to be holding the lamp")
+	}
+
+	assertMatch(t, "You give Lamp to jim.\r\n", bobConn.String())
+	assertMatch(t, "bob gives you Lamp.\r\n", jimConn.String())
+
+	doLook(world, bobClient, Command{"look", "jim", ""})
+
+	assertMatch(t, "Carrying:\r\n  Lamp\r\n", bobConn.String())
+}
+
+func TestFindTargetFindsThings(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	lamp, _ := world.NewThing("Lamp", hall)
+	book, _ := world.NewThing("Book", bob)
+
+	client := NewClient(NewMockConn())
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	if o, _ := world.FindTarget(client, Command{target: "LAMP"}); o != lamp {
+		t.Errorf("Expected to find the lamp in the room")
+	}
+
+	if o, _ := world.FindTarget(client, Command{target: "book"}); o != book {
+		t.Errorf("Expected to find the book in bob's inventory")
+	}
+}
+
+func TestDoCreateNeedsBuilder(t *testing.T) {
+	conn := NewMockConn()
+	client := NewClient(conn)
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+
+	doCreate(world, client, Command{"@create", "", "Lamp"})
+
+	if len(world.things) != 0 {
+		t.Fatalf("Expected bob not to be able to create things")
+	}
+
+	bob.SetFlag(BuilderFlag)
+	doCreate(world, client, Command{"@create", "", "Lamp"})
+
+	lamp := bob.FindThing("lamp")
+
+	if lamp == nil || lamp.Owner() != bob {
+		t.Fatalf("Expected bob to be holding a lamp he owns")
+	}
+
+	assertMatch(t, "Created Lamp \\(#3\\).\r\n", conn.String())
+}
+
+func TestThingsArePersistedAndJournaled(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "world.json")
+
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	lamp, _ := world.NewThing("Lamp", hall)
+	world.SetOwner(lamp, bob)
+	world.Save(snapshot)
+
+	loaded := reloadWorld(t, world)
+
+	if l := loaded.things[lamp.key]; l == nil || l.Location() != loaded.rooms[hall.key] || l.Owner() != loaded.players[bob.key] {
+		t.Fatalf("Expected the lamp to be restored in the hall")
+	}
+
+	path := openTestJournal(t, world)
+	world.MoveThing(lamp, bob)
+	book, _ := world.NewThing("Book", hall)
+
+	replayed, _ := LoadWorld(snapshot)
+
+	if _, err := ReplayJournal(replayed, path); err != nil {
+		t.Fatalf("Could not replay journal: %s", err)
+	}
+
+	if replayed.players[bob.key].FindThing("lamp") == nil {
+		t.Errorf("Expected bob to be holding the lamp after replay")
+	}
+
+	if replayed.rooms[hall.key].FindThing("book") == nil || replayed.things[book.key] == nil {
+		t.Errorf("Expected the book to be in the hall after replay")
+	}
+}
+
+func newContainerTest() (*World, *Client, *MockConn, *Player, *Thing) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bob, _ := world.NewPlayer("bob", "foo", hall)
+	bag, _ := world.NewThing("Bag", bob)
+	world.SetOwner(bag, bob)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "bob foo"})
+	doContainer(world, client, Command{"@container", "bag", ""})
+
+	return world, client, conn, bob, bag
+}
+
+func TestPutAndGetFromContainer(t *testing.T) {
+	world, client, conn, bob, bag := newContainerTest()
+	coin, _ := world.NewThing("Gold Coin", bob)
+
+	doPut(world, client, Command{"put", "", "gold coin in bag"})
+
+	if coin.Location() != bag || bob.FindThing("gold coin") != nil {
+		t.Fatalf("Expected the coin to be in the bag")
+	}
+
+	assertMatch(t, "You put Gold Coin in Bag.\r\n", conn.String())
+
+	doLook(world, client, Command{"look", "bag", ""})
+
+	assertMatch(t, "Contains:\r\n  Gold Coin\r\n", conn.String())
+
+	doGet(world, client, Command{"get", "gold coin from bag", ""})
+
+	if coin.Location() != bob {
+		t.Errorf("Expected bob to be holding the coin again")
+	}
+
+	assertMatch(t, "You take Gold Coin from Bag.\r\n", conn.String())
+}
+
+func TestClosedContainersCantBeUsed(t *testing.T) {
+	world, client, conn, bob, bag := newContainerTest()
+	coin, _ := world.NewThing("Coin", bob)
+
+	doClose(world, client, Command{"close", "bag", ""})
+
+	if bag.IsOpen() {
+		t.Fatalf("Expected the bag to be closed")
+	}
+
+	doPut(world, client, Command{"put", "", "coin in bag"})
+
+	if coin.Location() != bob {
+		t.Errorf("Expected the coin to stay out of the closed bag")
+	}
+
+	assertMatch(t, "Bag is closed.\r\n", conn.String())
+
+	doLook(world, client, Command{"look", "bag", ""})
+
+	assertMatch(t, "It is closed.\r\n", conn.String())
+
+	doOpen(world, client, Command{"open", "bag", ""})
+	doPut(world, client, Command{"put", "", "coin in bag"})
+
+	if coin.Location() != bag {
+		t.Errorf("Expected the coin to go in the open bag")
+	}
+}
+
+func TestContainersHaveCapacity(t *testing.T) {
+	world, client, conn, bob, bag := newContainerTest()
+	doContainer(world, client, Command{"@container", "bag", "1"})
+	world.NewThing("Coin", bob)
+	world.NewThing("Gem", bob)
+
+	doPut(world, client, Command{"put", "", "coin in bag"})
+	doPut(world, client, Command{"put", "", "gem in bag"})
+
+	if len(bag.Things()) != 1 || bob.FindThing("gem") == nil {
+		t.Errorf("Expected only one thing to fit in the bag")
+	}
+
+	assertMatch(t, "Bag is full.\r\n", conn.String())
+}
+
+func TestThingsCantGoInsideThemselves(t *testing.T) {
+	world, client, conn, bob, bag := newContainerTest()
+	box, _ := world.NewThing("Box", bob)
+	world.SetFlag(box, ContainerFlag)
+
+	doPut(world, client, Command{"put", "", "bag in bag"})
+
+	if bag.Location() != bob {
+		t.Errorf("Expected the bag not to go inside itself")
+	}
+
+	assertMatch(t, "Bag can't go inside itself.\r\n", conn.String())
+
+	doPut(world, client, Command{"put", "", "box in bag"})
+
+	if err := world.MoveThing(bag, box); err == nil || bag.Location() != bob {
+		t.Errorf("Expected the bag not to go inside the box inside it")
+	}
+}
+
+func TestLoadRejectsCyclesOfThings(t *testing.T) {
+	world := NewWorld()
+	hall, _ := world.NewRoom("The Hall")
+	bag, _ := world.NewThing("Bag", hall)
+	box, _ := world.NewThing("Box", bag)
+
+	// Force a cycle that MoveThing would refuse.
+	bag.location = box
+
+	var saved bytes.Buffer
+	world.encode(&saved)
+
+	if _, err := decodeWorld(&saved); err == nil {
+		t.Errorf("Expected a world with a cycle of things to be rejected")
+	}
+}
+
+func TestContainersArePersisted(t *testing.T) {
+	world, client, _, bob, bag := newContainerTest()
+	doContainer(world, client, Command{"@container", "bag", "3"})
+	world.NewThing("Coin", bag)
+	world.SetFlag(bag, ClosedFlag)
+
+	loaded := reloadWorld(t, world)
+	restored := loaded.players[bob.key].FindThing("bag")
+
+	if restored == nil || !restored.IsContainer() || restored.IsOpen() || restored.Capacity() != 3 {
+		t.Fatalf("Expected the closed bag to be restored")
+	}
+
+	if restored.FindThing("coin") == nil {
+		t.Errorf("Expected the coin to be restored inside the bag")
+	}
+}
+
+func TestDoContainerNeedsOwner(t *testing.T) {
+	world, _, _, bob, _ := newContainerTest()
+	jim, _ := world.NewPlayer("jim", "bar", bob.location)
+	box, _ := world.NewThing("Box", jim.location)
+	world.SetOwner(box, jim)
+
+	conn := NewMockConn()
+	client := NewClient(conn)
+	doConnect(world, client, Command{"connect", "", "jim bar"})
+	doContainer(world, client, Command{"@container", "box", "2"})
+
+	if !box.IsContainer() || box.Capacity() != 2 {
+		t.Errorf("Expected jim to be able to make his box a container")
+	}
+
+	client.player = bob
+	doContainer(world, client, Command{"@container", "box", "off"})
+
+	if !box.IsContainer() {
+		t.Errorf("Expected bob not to be able to change jim's box")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "mud.crt")
+	keyFile := filepath.Join(dir, "mud.key")
+
+	if err := generateCertificate(certFile, keyFile, []string{"localhost", "127.0.0.1"}); err != nil {
+		t.Fatalf("Could not generate certificate: %s", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestGenerateCertificate(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	data, _ := os.ReadFile(certFile)
+	block, _ := pem.Decode(data)
+
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("Expected a PEM encoded certificate")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %s", err)
+	}
+
+	if err = cert.VerifyHostname("localhost"); err != nil {
+		t.Errorf("Expected the certificate to be valid for localhost: %s", err)
+	}
+
+	if err = cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("Expected the certificate to be valid for 127.0.0.1: %s", err)
+	}
+
+	if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the key to be private, mode was %v", info.Mode())
+	}
+}
+
+func TestTLSListenerFeedsConnectionLoop(t *testing.T) {
+	runGlobalWorld()
+
+	certFile, keyFile := writeTestCertificate(t)
+
+	ln, err := listenTLS(0, certFile, keyFile)
+
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+
+	defer ln.Close()
+	go acceptLoop(ln, true)
+
+	secureLogin = true
+	defer func() { secureLogin = false }()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+
+	if err != nil {
+		t.Fatalf("Could not connect: %s", err)
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("connect nobody secret\r\n"))
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if err != nil {
+			t.Fatalf("Expected a reply to connect: %s", err)
+		}
+
+		if strings.Contains(line, "encrypted") {
+			t.Fatalf("Login should be allowed over TLS")
+		}
+
+		if strings.Contains(line, "No such player!") {
+			break
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package main
 
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
 //
 // Various utility functions used by handlers, etc.
 //
@@ -7,3 +14,224 @@ package main
 func hasBuildPermission(p *Player) bool {
 	return p.IsSet(WizardFlag) || p.IsSet(BuilderFlag)
 }
+
+//
+// May the player change the object? Owners and wizards may, and
+// players, who have no owner, may change themselves.
+//
+func controls(p *Player, o Objecter) bool {
+	return p == o || p == o.Owner() || p.IsSet(WizardFlag)
+}
+
+//
+// Fill in a builder's message for the player it's about: "%n" is the
+// player's name, and "%%" is a percent sign. Anything else is left
+// alone.
+//
+func substitute(msg string, p *Player) string {
+	var b strings.Builder
+
+	for i := 0; i < len(msg); i++ {
+		if msg[i] != '%' || i+1 == len(msg) {
+			b.WriteByte(msg[i])
+			continue
+		}
+
+		switch msg[i+1] {
+		case 'n', 'N':
+			b.WriteString(p.name)
+			i++
+		case '%':
+			b.WriteByte('%')
+			i++
+		default:
+			b.WriteByte('%')
+		}
+	}
+
+	return b.String()
+}
+
+//
+// When -secure-login is set, passwords are only accepted over TLS.
+// Tell the client where to go instead.
+//
+func canSendPassword(client *Client) bool {
+	if secureLogin && !client.secure {
+		client.Tell("Passwords are only accepted over an encrypted connection.")
+		client.Tell("Please reconnect using TLS on port %d.", TLSPORT)
+		return false
+	}
+
+	return true
+}
+
+//
+// Deliver a private message to a player wherever they are, and let
+// them reply to it.
+//
+func sendTell(client *Client, target *Player, msg string) {
+	if !target.awake || target.client == nil {
+		client.Tell("%s is asleep.", target.name)
+		return
+	}
+
+	target.client.Tell("%s tells you: %s", client.player.name, msg)
+	target.client.replyTo = client.player
+	client.Tell("You tell %s: %s", target.name, msg)
+}
+
+//
+// Find an open container the player is carrying or can see, or tell
+// them why not.
+//
+func findContainer(client *Client, name string) *Thing {
+	player := client.player
+	name = strings.TrimSpace(name)
+
+	container := player.FindThing(name)
+
+	if container == nil {
+		container = player.location.FindThing(name)
+	}
+
+	if container == nil {
+		client.Tell("I don't see %s here.", name)
+		return nil
+	}
+
+	if !container.IsContainer() {
+		client.Tell("%s isn't a container.", container.name)
+		return nil
+	}
+
+	if !container.IsOpen() {
+		client.Tell("%s is closed.", container.name)
+		return nil
+	}
+
+	return container
+}
+
+//
+// Find the object named in "<object>/<attr>", or tell the player why
+// not. The object defaults to here.
+//
+func findAttrTarget(world *World, client *Client, s string) (Objecter, string) {
+	object, name, ok := splitAttrTarget(s)
+
+	if !ok || !validAttrName(name) {
+		client.Tell("Try: <object>/<attribute>")
+		return nil, ""
+	}
+
+	target, err := world.FindTarget(client, Command{target: object})
+
+	if err != nil {
+		client.Tell("I don't see that here.")
+		return nil, ""
+	}
+
+	return target, name
+}
+
+//
+// Word-wrap text to the given width. Existing line breaks are kept,
+// as is any indentation at the start of a line. Words longer than
+// the width are broken where they fall. A width of 0 or less turns
+// wrapping off.
+//
+func wordWrap(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width && !strings.Contains(s, "\n") {
+		return s
+	}
+
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	wrapped := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		wrapped = append(wrapped, wrapLine(line, width)...)
+	}
+
+	return strings.Join(wrapped, "\r\n")
+}
+
+func wrapLine(line string, width int) []string {
+	if utf8.RuneCountInString(line) <= width {
+		return []string{line}
+	}
+
+	indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+	if len(indent) >= width {
+		indent = ""
+	}
+
+	var lines []string
+	current := indent
+	currentLen := len(indent)
+
+	for _, word := range strings.Fields(line) {
+		wordLen := utf8.RuneCountInString(word)
+
+		if currentLen > len(indent) && currentLen+1+wordLen > width {
+			lines = append(lines, current)
+			current, currentLen = indent, len(indent)
+		}
+
+		if currentLen > len(indent) {
+			current += " "
+			currentLen++
+		}
+
+		// Break up words that won't fit on a line of their own.
+		for currentLen+wordLen > width {
+			runes := []rune(word)
+			n := width - currentLen
+			lines = append(lines, current+string(runes[:n]))
+			current, currentLen = indent, len(indent)
+			word = string(runes[n:])
+			wordLen -= n
+		}
+
+		current += word
+		currentLen += wordLen
+	}
+
+	return append(lines, current)
+}
+
+//
+// How long someone has been connected, as "mm:ss" or "hh:mm:ss",
+// with a count of days in front once it gets that far.
+//
+func formatOnFor(d time.Duration) string {
+	secs := int(d / time.Second)
+	days, hours, mins := secs/86400, secs/3600%24, secs/60%60
+	secs %= 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %02d:%02d", days, hours, mins)
+	case hours > 0:
+		return fmt.Sprintf("%d:%02d:%02d", hours, mins, secs)
+	default:
+		return fmt.Sprintf("%d:%02d", mins, secs)
+	}
+}
+
+//
+// How long someone has been idle, in the biggest unit that fits,
+// e.g. "42s", "5m", "3h" or "2d".
+//
+func formatIdle(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
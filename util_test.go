@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 )
 
 func TestHasPermissionRespectsBuilderFlag(t *testing.T) {
@@ -35,3 +36,93 @@ func TestHasPermissionRespectsWizardFlag(t *testing.T) {
 		t.Errorf("Jim should have build permission.")
 	}
 }
+
+func TestSubstitute(t *testing.T) {
+	bob := &Player{}
+	bob.SetName("Bob")
+
+	cases := map[string]string{
+		"%n leaves.":       "Bob leaves.",
+		"%N and %n":        "Bob and Bob",
+		"100%% sure, %n":   "100% sure, Bob",
+		"%x stays, 50%":    "%x stays, 50%",
+		"no substitutions": "no substitutions",
+	}
+
+	for in, want := range cases {
+		if got := substitute(in, bob); got != want {
+			t.Errorf("Expected %q to become %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestWordWrapLeavesShortLinesAlone(t *testing.T) {
+	if wrapped := wordWrap("A short line.", 20); wrapped != "A short line." {
+		t.Errorf("Expected line to be unchanged, got %q", wrapped)
+	}
+}
+
+func TestWordWrapBreaksOnSpaces(t *testing.T) {
+	wrapped := wordWrap("The quick brown fox jumps over the lazy dog.", 15)
+	expected := "The quick brown\r\nfox jumps over\r\nthe lazy dog."
+
+	if wrapped != expected {
+		t.Errorf("Expected %q, got %q", expected, wrapped)
+	}
+}
+
+func TestWordWrapKeepsLineBreaksAndIndent(t *testing.T) {
+	wrapped := wordWrap("Exits:\n  a long winding road", 12)
+	expected := "Exits:\r\n  a long\r\n  winding\r\n  road"
+
+	if wrapped != expected {
+		t.Errorf("Expected %q, got %q", expected, wrapped)
+	}
+}
+
+func TestWordWrapBreaksLongWords(t *testing.T) {
+	wrapped := wordWrap("go supercalifragilistic", 10)
+	expected := "go\r\nsupercalif\r\nragilistic"
+
+	if wrapped != expected {
+		t.Errorf("Expected %q, got %q", expected, wrapped)
+	}
+}
+
+func TestWordWrapCanBeTurnedOff(t *testing.T) {
+	long := "The quick brown fox jumps over the lazy dog."
+
+	if wrapped := wordWrap(long, 0); wrapped != long {
+		t.Errorf("Expected no wrapping, got %q", wrapped)
+	}
+}
+
+func TestFormatOnFor(t *testing.T) {
+	cases := map[time.Duration]string{
+		42 * time.Second:              "0:42",
+		3*time.Minute + 5*time.Second: "3:05",
+		time.Hour + 2*time.Minute:     "1:02:00",
+		50*time.Hour + 7*time.Minute:  "2d 02:07",
+	}
+
+	for d, expected := range cases {
+		if s := formatOnFor(d); s != expected {
+			t.Errorf("Expected %v to be %q, got %q", d, expected, s)
+		}
+	}
+}
+
+func TestFormatIdle(t *testing.T) {
+	cases := map[time.Duration]string{
+		42 * time.Second: "42s",
+		90 * time.Second: "1m",
+		3 * time.Hour:    "3h",
+		49 * time.Hour:   "2d",
+	}
+
+	for d, expected := range cases {
+		if s := formatIdle(d); s != expected {
+			t.Errorf("Expected %v to be %q, got %q", d, expected, s)
+		}
+	}
+}
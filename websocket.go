@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"embed"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// A minimal WebSocket (RFC 6455) server, so that players can connect
+// from a browser. Each socket is wrapped up as a net.Conn and handed
+// to the same connectionLoop as a telnet connection.
+//
+
+//go:embed web
+var webFiles embed.FS
+
+// Magic value used to prove the server understood the handshake
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The biggest frame we'll accept from a browser
+const MAX_FRAME = 64 * 1024
+
+// WebSocket frame opcodes
+const (
+	wsContinuation byte = 0x0
+	wsText         byte = 0x1
+	wsBinary       byte = 0x2
+	wsClose        byte = 0x8
+	wsPing         byte = 0x9
+	wsPong         byte = 0xA
+)
+
+//
+// Serve the web client at / and the WebSocket endpoint at /ws.
+//
+func webHandler() http.Handler {
+	// Can't fail, the directory is embedded at compile time.
+	files, _ := fs.Sub(webFiles, "web")
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(files)))
+	mux.HandleFunc("/ws", serveWebSocket)
+	return mux
+}
+
+func serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r)
+
+	if err != nil {
+		infoLog.Println("WebSocket upgrade failed for", r.RemoteAddr, err)
+		return
+	}
+
+	infoLog.Println("Accepted WebSocket connection from:", conn.RemoteAddr())
+
+	connectionLoop(NewPlainClient(conn))
+}
+
+//
+// Check the opening handshake, and take over the connection.
+//
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	if r.Method != "GET" ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("Not a WebSocket request")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("Unsupported WebSocket version")
+	}
+
+	if !sameOrigin(r) {
+		http.Error(w, "WebSockets may only be opened from this server's pages", http.StatusForbidden)
+		return nil, errors.New("Refused WebSocket from origin " + r.Header.Get("Origin"))
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("Missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+
+	if !ok {
+		http.Error(w, "Can't upgrade this connection", http.StatusInternalServerError)
+		return nil, errors.New("Connection can't be hijacked")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")
+
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{Conn: conn, reader: rw.Reader}, nil
+}
+
+//
+// Browsers send the origin of the page that opened a WebSocket, and
+// will open one for any page. Only our own pages may, so that another
+// site can't start a game session in a player's browser. Clients that
+// aren't browsers don't send an origin at all.
+//
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func wsAccept(key string) string {
+	hash := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func headerContains(h http.Header, name string, value string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//
+// wsConn adapts a WebSocket to net.Conn. Reads return the payload of
+// data frames, and each Write is sent as one text frame.
+//
+type wsConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	// What's left of the frame currently being read
+	pending []byte
+
+	// Frames may be written by any goroutine that Tells this client
+	writeLock sync.Mutex
+	closed    bool
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		opcode, payload, err := c.readFrame()
+
+		if err != nil {
+			return 0, err
+		}
+
+		switch opcode {
+		case wsText, wsBinary, wsContinuation:
+			c.pending = payload
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+		case wsClose:
+			c.writeFrame(wsClose, nil)
+			return 0, io.EOF
+		}
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+func (c *wsConn) readFrame() (opcode byte, payload []byte, err error) {
+	var header [2]byte
+
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return
+	}
+
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	// Everything a browser sends us must be masked.
+	if !masked {
+		err = errors.New("Unmasked WebSocket frame")
+		return
+	}
+
+	if length > MAX_FRAME {
+		err = errors.New("WebSocket frame too large")
+		return
+	}
+
+	var mask [4]byte
+
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return
+	}
+
+	payload = make([]byte, length)
+
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	// Browsers drop the connection if a text frame isn't valid UTF-8.
+	text := []byte(strings.ToValidUTF8(string(b), "\uFFFD"))
+
+	if err := c.writeFrame(wsText, text); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	header := []byte{0x80 | opcode}
+	length := len(payload)
+
+	switch {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126, byte(length>>8), byte(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if _, err := c.Conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+
+	if opcode == wsClose {
+		c.closed = true
+	}
+
+	return nil
+}
+
+func (c *wsConn) Close() error {
+	c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrame(wsClose, []byte{0x03, 0xE8}) // 1000, normal closure
+	return c.Conn.Close()
+}
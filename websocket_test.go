@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write a masked frame, the way a browser would.
+func writeClientFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	length := len(payload)
+
+	switch {
+	case length < 126:
+		header = append(header, 0x80|byte(length))
+	default:
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	}
+
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	header = append(header, mask...)
+
+	masked := make([]byte, length)
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+
+	_, err := w.Write(append(header, masked...))
+	return err
+}
+
+// Read an unmasked frame, the way a browser would.
+func readServerFrame(r io.Reader) (byte, []byte, error) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(header[1] & 0x7F)
+
+	if length == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+
+	payload := make([]byte, length)
+	_, err := io.ReadFull(r, payload)
+
+	return header[0] & 0x0F, payload, err
+}
+
+func newTestWsConn() (*wsConn, net.Conn) {
+	server, browser := net.Pipe()
+	return &wsConn{Conn: server, reader: bufio.NewReader(server)}, browser
+}
+
+func TestWsAccept(t *testing.T) {
+	// The example from RFC 6455
+	if accept := wsAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept value %s", accept)
+	}
+}
+
+func TestWsConnReadsMaskedFrames(t *testing.T) {
+	conn, browser := newTestWsConn()
+	defer browser.Close()
+
+	go func() {
+		writeClientFrame(browser, wsText, []byte("look\n"))
+		writeClientFrame(browser, wsText, bytes.Repeat([]byte("x"), 200))
+	}()
+
+	buf := make([]byte, 1024)
+
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "look\n" {
+		t.Errorf("Expected to read 'look', got %q (%v)", buf[:n], err)
+	}
+
+	n, err = conn.Read(buf)
+	if err != nil || n != 200 {
+		t.Errorf("Expected to read 200 bytes, got %d (%v)", n, err)
+	}
+}
+
+func TestWsConnWritesTextFrames(t *testing.T) {
+	conn, browser := newTestWsConn()
+	defer browser.Close()
+
+	go conn.Write([]byte("Hello, world!\r\n"))
+
+	opcode, payload, err := readServerFrame(browser)
+
+	if err != nil || opcode != wsText || string(payload) != "Hello, world!\r\n" {
+		t.Errorf("Unexpected frame %d %q (%v)", opcode, payload, err)
+	}
+}
+
+func TestWsConnAnswersPings(t *testing.T) {
+	conn, browser := newTestWsConn()
+	defer browser.Close()
+
+	go func() {
+		writeClientFrame(browser, wsPing, []byte("hi"))
+		opcode, payload, _ := readServerFrame(browser)
+		if opcode == wsPong && string(payload) == "hi" {
+			writeClientFrame(browser, wsText, []byte("ok"))
+		}
+	}()
+
+	buf := make([]byte, 16)
+	n, _ := conn.Read(buf)
+
+	if string(buf[:n]) != "ok" {
+		t.Errorf("Expected ping to be answered with a pong")
+	}
+}
+
+func TestWsConnCloseFrameEndsInput(t *testing.T) {
+	conn, browser := newTestWsConn()
+	defer browser.Close()
+
+	go func() {
+		writeClientFrame(browser, wsClose, nil)
+		readServerFrame(browser)
+	}()
+
+	if _, err := conn.Read(make([]byte, 16)); err != io.EOF {
+		t.Errorf("Expected EOF after a close frame, got %v", err)
+	}
+}
+
+func TestWsConnRejectsUnmaskedFrames(t *testing.T) {
+	conn, browser := newTestWsConn()
+	defer browser.Close()
+
+	go browser.Write([]byte{0x81, 0x02, 'h', 'i'})
+
+	if _, err := conn.Read(make([]byte, 16)); err == nil {
+		t.Errorf("Expected an unmasked frame to be rejected")
+	}
+}
+
+func TestWebHandlerServesClientPage(t *testing.T) {
+	server := httptest.NewServer(webHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+
+	if err != nil {
+		t.Fatalf("Could not fetch page: %s", err)
+	}
+
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != 200 || !strings.Contains(string(body), "new WebSocket") {
+		t.Errorf("Expected the web client page, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebHandlerRejectsPlainRequests(t *testing.T) {
+	server := httptest.NewServer(webHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ws")
+
+	if err != nil {
+		t.Fatalf("Could not fetch endpoint: %s", err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a bad request, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebSocketRefusesOtherOrigins(t *testing.T) {
+	server := httptest.NewServer(webHandler())
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/ws", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Origin", "http://evil.example.com")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("Could not fetch endpoint: %s", err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected another site's page to be refused, got %d", resp.StatusCode)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://mud.example.com:8080/ws", nil)
+
+	if !sameOrigin(r) {
+		t.Errorf("Expected a request with no origin to be allowed")
+	}
+
+	r.Header.Set("Origin", "http://MUD.example.com:8080")
+
+	if !sameOrigin(r) {
+		t.Errorf("Expected our own pages to be allowed")
+	}
+
+	for _, origin := range []string{"http://evil.example.com", "http://mud.example.com:9090", "null"} {
+		r.Header.Set("Origin", origin)
+
+		if sameOrigin(r) {
+			t.Errorf("Expected %q to be refused", origin)
+		}
+	}
+}
+
+func TestWebSocketReachesConnectionLoop(t *testing.T) {
+	server := httptest.NewServer(webHandler())
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+
+	if err != nil {
+		t.Fatalf("Could not connect: %s", err)
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected to switch protocols, got %v (%v)", resp, err)
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept header")
+	}
+
+	// The welcome banner, with no telnet negotiation before it.
+	_, payload, err := readServerFrame(reader)
+
+	if err != nil || !strings.HasPrefix(string(payload), "-----") {
+		t.Fatalf("Expected the welcome banner, got %q (%v)", payload, err)
+	}
+
+	for !strings.HasPrefix(string(payload), "To leave the game") {
+		if _, payload, err = readServerFrame(reader); err != nil {
+			t.Fatalf("Could not read the welcome banner: %s", err)
+		}
+	}
+
+	writeClientFrame(conn, wsText, []byte("quit\n"))
+
+	for {
+		opcode, _, err := readServerFrame(reader)
+
+		if err != nil {
+			t.Fatalf("Expected the server to close the socket: %s", err)
+		}
+
+		if opcode == wsClose {
+			break
+		}
+	}
+}
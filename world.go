@@ -2,7 +2,9 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 )
 
 type SequentialIdGen func() int
@@ -12,7 +14,15 @@ type SequentialIdGen func() int
 //
 
 func KeyGen() func() int {
-	c := 0
+	return KeyGenFrom(0)
+}
+
+//
+// Generate unique IDs for objects, picking up after the last key
+// handed out. Used to resume key generation for a loaded world.
+//
+func KeyGenFrom(last int) func() int {
+	c := last
 	return func() int {
 		c += 1
 		return c
@@ -27,22 +37,157 @@ type World struct {
 	players map[int]*Player
 	rooms   map[int]*Room
 	exits   map[int]*Exit
+	things  map[int]*Thing
+	journal *Journal
+
+	// Keys of destroyed objects, and whether they may be used again
+	freeKeys  []int
+	keyPolicy KeyPolicy
+
+	// Go event handlers by object key, and how deeply events are
+	// setting off other events
+	subscribers map[int]map[string][]EventHandler
+	eventDepth  int
+
+	// Where the time comes from, and timers waiting to run
+	clock     Clock
+	timers    timerQueue
+	timerIDs  map[TimerID]*timer
+	lastTimer TimerID
+
+	// Work for the world's goroutine to do, and whether it's running
+	requests chan worldRequest
+	running  bool
 }
 
 func NewWorld() *World {
-	return &World{KeyGen(), make(map[int]*Player), make(map[int]*Room), make(map[int]*Exit)}
+	return &World{idGen: KeyGen(), players: make(map[int]*Player), rooms: make(map[int]*Room),
+		exits: make(map[int]*Exit), things: make(map[int]*Thing), requests: make(chan worldRequest)}
+}
+
+type worldRequest struct {
+	fn   func(w *World)
+	done chan struct{}
+}
+
+//
+// The world belongs to a single goroutine, which runs players'
+// commands and timers one at a time, so nothing in it needs locking.
+// Anything else that wants to look at or change the world, such as
+// a connection with a line of input, hands the work over with Do.
+// Run returns when stop is closed, after which the caller owns the
+// world.
+//
+func (w *World) Run(tick time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	w.running = true
+	defer func() { w.running = false }()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case r := <-w.requests:
+			r.fn(w)
+			close(r.done)
+		case <-ticker.C:
+			w.RunTimers()
+		}
+	}
+}
+
+//
+// Have the world's goroutine run fn, and wait for it to finish. Must
+// not be called from the world's goroutine itself.
+//
+func (w *World) Do(fn func(w *World)) {
+	done := make(chan struct{})
+	w.requests <- worldRequest{fn: fn, done: done}
+	<-done
+}
+
+//
+// Run work away from the world's goroutine, then fn back on it. This
+// is for slow work that doesn't touch the world, like hashing a
+// password, so it doesn't hold up everyone else. When the world isn't
+// running, e.g. in tests, both are run straight away.
+//
+func (w *World) Offload(work func(), fn func(w *World)) {
+	if !w.running {
+		work()
+		fn(w)
+		return
+	}
+
+	go func() {
+		work()
+		w.Do(fn)
+	}()
+}
+
+//
+// Offload work a client is waiting on, such as checking the password
+// it connected with. Anything the client types in the meantime is held
+// until fn has run, so it doesn't jump the queue, and fn doesn't run
+// at all if the client has gone by then.
+//
+func (w *World) offloadFor(client *Client, work func(), fn func(w *World)) {
+	client.waiting = true
+
+	w.Offload(work, func(w *World) {
+		client.waiting = false
+
+		if client.quitRequested {
+			return
+		}
+
+		fn(w)
+
+		// handleLines leaves itself in resume, since naming it here
+		// would make the command table refer to itself.
+		held, resume := client.held, client.resume
+		client.held, client.resume = nil, nil
+
+		if resume != nil {
+			resume(client, held)
+		}
+
+		// The client's reader only looks for a quit after its next
+		// read, which may never come, so wake it by closing the
+		// connection.
+		if client.quitRequested {
+			client.Close()
+		}
+	})
 }
 
 func (w *World) NewRoom(name string) (r *Room, err error) {
 	normalName := strings.ToLower(name)
 
-	r = &Room{Object: Object{key: w.idGen(), name: name, normalName: normalName},
+	r = &Room{Object: Object{key: w.newKey(), name: name, normalName: normalName},
 		exits: make(map[int]*Exit), players: make(map[int]*Player)}
 	w.rooms[r.key] = r
+	w.record(JournalEntry{Op: opNewRoom, Key: r.key, Name: name})
 	return
 }
 
-func (w *World) NewPlayer(name string, password string, location *Room) (p *Player, err error) {
+//
+// Make a new player. Hashing the password is slow, so the world's
+// goroutine should hash it with Offload and use NewPlayerWithHash.
+//
+func (w *World) NewPlayer(name string, password string, location *Room) (*Player, error) {
+	hash, err := hashPassword(password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return w.NewPlayerWithHash(name, hash, location)
+}
+
+func (w *World) NewPlayerWithHash(name string, hash string, location *Room) (p *Player, err error) {
 	normalName := strings.ToLower(name)
 
 	for _, player := range w.players {
@@ -52,76 +197,322 @@ func (w *World) NewPlayer(name string, password string, location *Room) (p *Play
 		}
 	}
 
-	p = &Player{Object: Object{key: w.idGen()}}
+	p = &Player{Object: Object{key: w.newKey()}, password: hash}
 
 	p.SetName(name)
-	p.SetPassword(password)
 	w.players[p.key] = p
-	w.MovePlayer(p, location)
+	w.movePlayer(p, location)
+	w.record(JournalEntry{Op: opNewPlayer, Key: p.key, Name: name,
+		Password: p.password, Location: location.key})
 
 	return
 }
 
 // Move a player to a new room. Returns the player's new location,
-// and an error if the player could not be moved.
+// and a LockedError if the room's lock kept them out.
 func (w *World) MovePlayer(p *Player, d *Room) (*Room, error) {
-	p.Lock()
-	defer p.Unlock()
+	if err := checkLock(p, d, "You can't go in there."); err != nil {
+		return p.location, err
+	}
+
+	// Nobody leaves or arrives if they're going where they already are.
+	from := p.location
+	moved := from != d
 
-	d.Lock()
-	defer d.Unlock()
+	if moved {
+		w.emit(Event{Kind: EventLeave, Actor: p, Room: from})
+	}
+
+	r, err := w.movePlayer(p, d)
+
+	if err == nil {
+		w.record(JournalEntry{Op: opMovePlayer, Key: p.key, Location: d.key})
+
+		if p.client != nil {
+			p.client.sendRoomInfo(r)
+		}
 
-	oldRoom := p.location
+		if moved {
+			w.emit(Event{Kind: EventEnter, Actor: p, Room: r})
+		}
+	}
 
-	if oldRoom != nil {
-		oldRoom.Lock()
-		defer oldRoom.Unlock()
+	return r, err
+}
 
+func (w *World) movePlayer(p *Player, d *Room) (*Room, error) {
+	if oldRoom := p.location; oldRoom != nil {
 		delete(oldRoom.players, p.key)
 	}
 
 	p.location = d
 	d.players[p.key] = p
 
-	// Error may become non-nil in the future, when exits and rooms
-	// have guards / locks
-
 	return d, nil
 }
 
-func (w *World) NewExit(source *Room, name string, destination *Room) (e *Exit, err error) {
-	normalName := strings.ToLower(name)
+//
+// Take a player through an exit, if the exit's lock and then the
+// destination's will let them.
+//
+func (w *World) UseExit(p *Player, e *Exit) (*Room, error) {
+	if e.destination == nil {
+		return p.location, errors.New("That exit doesn't lead anywhere.")
+	}
 
-	for _, exit := range source.exits {
-		if exit.NormalName() == normalName {
-			err = errors.New("An exit with that name already exists.")
-			return
-		}
+	if err := checkLock(p, e, "You can't go that way."); err != nil {
+		return p.location, err
 	}
 
-	e = &Exit{Object: Object{key: w.idGen()}, destination: destination}
+	return w.MovePlayer(p, e.destination)
+}
+
+func (w *World) NewExit(source *Room, name string, destination *Room) (e *Exit, err error) {
+	if err = source.CheckExitName(name); err != nil {
+		return
+	}
+
+	e = &Exit{Object: Object{key: w.newKey()}, destination: destination}
 	e.SetName(name)
 	w.exits[e.key] = e
 	source.exits[e.key] = e
+	w.record(JournalEntry{Op: opNewExit, Key: e.key, Name: name,
+		Location: source.key, Destination: destination.key})
 
 	return
 }
 
+func (w *World) NewThing(name string, location Holder) (t *Thing, err error) {
+	if strings.TrimSpace(name) == "" {
+		err = errors.New("Things must have a name.")
+		return
+	}
+
+	t = &Thing{Object: Object{key: w.newKey()}}
+	t.SetName(name)
+	w.things[t.key] = t
+	w.moveThing(t, location)
+	w.record(JournalEntry{Op: opNewThing, Key: t.key, Name: name, Location: location.Key()})
+
+	return
+}
+
+// Move a thing into a room, a player's hands, or a container.
+func (w *World) MoveThing(t *Thing, to Holder) error {
+	if container, isThing := to.(*Thing); isThing && container.Full() && t.location != to {
+		return fmt.Errorf("%s is full.", container.name)
+	}
+
+	if err := w.moveThing(t, to); err != nil {
+		return err
+	}
+
+	w.record(JournalEntry{Op: opMoveThing, Key: t.key, Location: to.Key()})
+	return nil
+}
+
+// Pick up a thing, if its lock will let the player.
+func (w *World) TakeThing(p *Player, t *Thing) error {
+	if err := checkLock(p, t, "You can't pick that up."); err != nil {
+		return err
+	}
+
+	return w.MoveThing(t, p)
+}
+
+//
+// Nothing may end up inside itself. Every move goes through here,
+// including those replayed from the journal or made while loading,
+// so there can never be a cycle of things in the world.
+//
+func (w *World) moveThing(t *Thing, to Holder) error {
+	if t.Encloses(to) {
+		return fmt.Errorf("%s can't go inside itself.", t.name)
+	}
+
+	if t.location != nil {
+		t.location.contents().remove(t)
+	}
+
+	t.location = to
+	to.contents().add(t)
+
+	return nil
+}
+
+// Look up anything that can hold things by its key.
+func (w *World) holder(key int) (Holder, bool) {
+	if r, exists := w.rooms[key]; exists {
+		return r, true
+	}
+
+	if p, exists := w.players[key]; exists {
+		return p, true
+	}
+
+	if t, exists := w.things[key]; exists {
+		return t, true
+	}
+
+	return nil, false
+}
+
+func (w *World) SetCapacity(t *Thing, capacity int) {
+	t.capacity = capacity
+	w.record(JournalEntry{Op: opSetCapacity, Key: t.key, Capacity: capacity})
+}
+
+func (w *World) SetDescription(o Objecter, s string) {
+	o.SetDescription(s)
+	w.record(JournalEntry{Op: opSetDescription, Key: o.Key(), Text: s})
+}
+
+// Lock an object, or unlock it with a nil lock.
+func (w *World) SetLock(o Objecter, l LockExpr) {
+	text := ""
+
+	if l != nil {
+		text = l.String()
+	}
+
+	o.SetLockExpr(l)
+	w.record(JournalEntry{Op: opSetLock, Key: o.Key(), Text: text})
+}
+
+func (w *World) SetFailMessage(o Objecter, s string) {
+	o.SetFailMessage(s)
+	w.record(JournalEntry{Op: opSetFail, Key: o.Key(), Text: s})
+}
+
+func (w *World) SetExitMessage(e *Exit, kind string, msg string) {
+	e.SetMessage(kind, msg)
+	w.record(JournalEntry{Op: opSetExitMessage, Key: e.key, Name: kind, Text: msg})
+}
+
+func (w *World) SetAttribute(o Objecter, name string, value string) {
+	o.SetAttribute(name, value)
+	w.record(JournalEntry{Op: opSetAttr, Key: o.Key(), Name: normalAttrName(name), Text: value})
+}
+
+func (w *World) ClearAttribute(o Objecter, name string) {
+	o.ClearAttribute(name)
+	w.record(JournalEntry{Op: opClearAttr, Key: o.Key(), Name: normalAttrName(name)})
+}
+
+func (w *World) SetAttributeFlags(o Objecter, name string, f AttrFlags) {
+	o.SetAttributeFlags(name, f)
+	w.record(JournalEntry{Op: opSetAttrFlags, Key: o.Key(), Name: normalAttrName(name),
+		AttrFlags: f})
+}
+
+func (w *World) SetFlag(o Objecter, f Flags) {
+	o.SetFlag(f)
+	w.record(JournalEntry{Op: opSetFlag, Key: o.Key(), Flags: f})
+}
+
+func (w *World) ClearFlag(o Objecter, f Flags) {
+	o.ClearFlag(f)
+	w.record(JournalEntry{Op: opClearFlag, Key: o.Key(), Flags: f})
+}
+
+func (w *World) SetOwner(o Objecter, p *Player) {
+	o.SetOwner(p)
+	w.record(JournalEntry{Op: opSetOwner, Key: o.Key(), Owner: p.key})
+}
+
+//
+// Replace a password hash that was stored with an old scheme with the
+// new one checkPassword made while checking it. We only have the plain
+// text when the player logs in, so that's when this is called. If the
+// stored hash is no longer old, it changed while it was being checked
+// and is left alone.
+//
+func (w *World) UpgradePassword(p *Player, old string, hash string) {
+	if hash == "" || p.password != old {
+		return
+	}
+
+	p.password = hash
+	w.record(JournalEntry{Op: opSetPassword, Key: p.key, Password: p.password})
+}
+
+func (w *World) AddPublicKey(p *Player, key string) {
+	p.addPublicKey(key)
+	w.record(JournalEntry{Op: opAddPublicKey, Key: p.key, Text: key})
+}
+
+func (w *World) RemovePublicKey(p *Player, key string) {
+	if p.removePublicKey(key) {
+		w.record(JournalEntry{Op: opRemovePublicKey, Key: p.key, Text: key})
+	}
+}
+
+// Look up a player by name, ignoring case.
+func (w *World) FindPlayer(name string) *Player {
+	normalName := strings.ToLower(name)
+
+	for _, p := range w.players {
+		if p.normalName == normalName {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Look up any object in the world by its key.
+func (w *World) object(key int) (o Objecter, exists bool) {
+	if r, exists := w.rooms[key]; exists {
+		return r, true
+	}
+
+	if e, exists := w.exits[key]; exists {
+		return e, true
+	}
+
+	if p, exists := w.players[key]; exists {
+		return p, true
+	}
+
+	if t, exists := w.things[key]; exists {
+		return t, true
+	}
+
+	return nil, false
+}
+
 func (world *World) connectPlayer(client *Client, player *Player) {
 	client.player = player
 	client.player.awake = true
 	client.player.client = client
+	client.connectedAt = time.Now()
+	client.lastInput = client.connectedAt
 	client.Tell("Welcome, %s!", player.name)
+	client.sendCharStatus()
+	client.sendRoomInfo(player.location)
 	// world.lookHere(client)
 	client.lookAt(client.player.location)
-	world.TellAllButMe(client.player, player.name+" has connected.")
+	world.TellAllButMe(client.player, "%s has connected.", player.name)
+	world.emit(Event{Kind: EventConnect, Actor: player, Room: player.location})
+}
+
+func (world *World) disconnectPlayer(client *Client) {
+	player := client.player
+
+	world.TellAllButMe(player, "%s has disconnected.", player.name)
+	player.awake = false
+	player.client = nil
+	client.player = nil
+	world.emit(Event{Kind: EventDisconnect, Actor: player, Room: player.location})
 }
 
 func (w *World) handleCommand(handlerMap *HandlerMap, client *Client, command Command) {
 	description, exists := (*handlerMap)[command.verb]
 
 	if !exists {
-		client.Tell("Huh?")
+		if client.player == nil || !w.runVerb(client, command) {
+			client.Tell("Huh?")
+		}
 		return
 	}
 
@@ -165,11 +556,9 @@ func (w *World) FindTarget(c *Client, cmd Command) (o Objecter, err error) {
 	}
 
 	// Maybe it's an exit
-	for _, e := range here.exits {
-		if e.NormalName() == target {
-			o = e
-			return
-		}
+	if e := here.FindExit(target); e != nil {
+		o = e
+		return
 	}
 
 	// Maybe it's a player
@@ -180,5 +569,16 @@ func (w *World) FindTarget(c *Client, cmd Command) (o Objecter, err error) {
 		}
 	}
 
+	// Maybe it's something we're carrying, or something lying here
+	if t := c.player.FindThing(target); t != nil {
+		o = t
+		return
+	}
+
+	if t := here.FindThing(target); t != nil {
+		o = t
+		return
+	}
+
 	return nil, errors.New("Target not found")
 }